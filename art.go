@@ -5,6 +5,7 @@
 package art
 
 import (
+	"sync"
 	"sync/atomic"
 	"unsafe"
 )
@@ -14,10 +15,21 @@ import (
 // It support thread safe concurrent update and query.
 type ART struct {
 	root unsafe.Pointer
+
+	// observers is a *observers replaced as a whole with observeMu held, so writers only load it.
+	observers unsafe.Pointer
+	observeMu sync.Mutex
+
+	// expiring is set once a key is put with TTL, expiration is only checked after it.
+	expiring uint32
+	sweeper  sweeper
 }
 
 // OpFunc is ART query callback function.
 // If OpFunc return true the current query will terminate immediately.
+// OpFunc may Put or Delete keys of the tree being iterated, including the current key.
+// The iteration always resume after the current key, so a key added ahead of the current key
+// will be visited, and a key deleted before being reached will not.
 type OpFunc func(key []byte, value interface{}) (end bool)
 
 // NewART create a new empty ART.
@@ -30,31 +42,44 @@ func NewART() *ART {
 // Get lookup this tree, and return the value associate with the given key.
 // This operation is thread safe.
 func (t *ART) Get(key []byte) (interface{}, bool) {
+	now := t.now()
 	for {
 		n := (*node)(atomic.LoadPointer(&t.root))
-		if value, ex, ok := n.searchOpt(key, 0, nil, 0); ok {
+		if value, _, ex, ok := n.searchOpt(key, 0, nil, 0, nil, now); ok {
 			return value, ex
 		}
 	}
 }
 
 // Put put the given key and value into this tree, or replace exist key's value.
+// The put is dropped if it's vetoed by a HookBefore hook, use PutContext to get the error.
 // This operation is thread safe.
 func (t *ART) Put(key []byte, value interface{}) {
+	g := t.guard(key, value)
 	for {
 		n := (*node)(atomic.LoadPointer(&t.root))
-		if n.insertOpt(key, value, 0, nil, 0, &t.root) {
+		if old, replaced, ok := n.insertOpt(key, value, 0, nil, 0, &t.root, nil, g); ok {
+			if g.vetoed() == nil {
+				t.notifyExpired(g)
+				t.notify(EventPut, key, old, value, replaced)
+			}
 			return
 		}
 	}
 }
 
 // Delete delete the given key and it's value from this tree.
+// The delete is dropped if it's vetoed by a HookBefore hook, use DeleteContext to get the error.
 // This operation is thread safe.
 func (t *ART) Delete(key []byte) {
+	g := t.guard(key, nil)
 	for {
 		n := (*node)(atomic.LoadPointer(&t.root))
-		if n.removeOpt(key, 0, nil, 0, &t.root) {
+		if old, removed, ok := n.removeOpt(key, 0, nil, 0, &t.root, nil, g); ok {
+			t.notifyExpired(g)
+			if removed {
+				t.notify(EventDelete, key, old, nil, true)
+			}
 			return
 		}
 	}
@@ -63,10 +88,15 @@ func (t *ART) Delete(key []byte) {
 // Prefix find all key have the given prefix in this tree.
 // This operation is thread safe.
 func (t *ART) Prefix(prefix []byte, f OpFunc) {
-	end := make([]byte, len(prefix))
-	copy(end, prefix)
-	end[len(end)-1]++
-	t.Range(prefix, end, true, false, f)
+	end, bounded := prefixSuccessor(prefix)
+	it := &iterator{
+		end:          end,
+		begin:        prefix,
+		includeBegin: true,
+		unbounded:    !bounded,
+		f:            f,
+	}
+	t.iterate(it)
 }
 
 // Range iterate the key in the given range.
@@ -79,13 +109,7 @@ func (t *ART) Range(begin, end []byte, includeBegin, includeEnd bool, f OpFunc)
 		includeEnd:   includeEnd,
 		f:            f,
 	}
-	for {
-		n := (*node)(atomic.LoadPointer(&t.root))
-		end, ok := n.iterOpt(it, 0, nil, 0, 0, 0)
-		if ok && end {
-			return
-		}
-	}
+	t.iterate(it)
 }
 
 // RangeTop is same as Range, but it will terminate after find k keys.
@@ -99,33 +123,96 @@ func (t *ART) RangeTop(k int, begin, end []byte, includeBegin, includeEnd bool,
 		k:            k,
 	}
 	it.setTopKOp(f)
-	for {
-		n := (*node)(atomic.LoadPointer(&t.root))
-		end, ok := n.iterOpt(it, 0, nil, 0, 0, 0)
-		if ok && end {
-			return
-		}
-	}
+	t.iterate(it)
 }
 
 // Min return the minimal key and it's value in this tree.
+// found is false if this tree is empty.
 // This operation is thread safe.
-func (t *ART) Min() ([]byte, interface{}) {
+func (t *ART) Min() (key []byte, value interface{}, found bool) {
+	return t.unexpired(func() ([]byte, interface{}, bool) {
+		for {
+			n := (*node)(atomic.LoadPointer(&t.root))
+			if k, v, ex, ok := n.minimalOpt(nil, 0); ok {
+				return k, v, ex
+			}
+		}
+	})
+}
+
+// Max return the maximal key and it's value in this tree.
+// found is false if this tree is empty.
+// This operation is thread safe.
+func (t *ART) Max() (key []byte, value interface{}, found bool) {
+	return t.unexpired(func() ([]byte, interface{}, bool) {
+		for {
+			n := (*node)(atomic.LoadPointer(&t.root))
+			if k, v, ex, ok := n.maximalOpt(nil, 0); ok {
+				return k, v, ex
+			}
+		}
+	})
+}
+
+// PopMin remove the minimal key from this tree, and return the key and it's value.
+// ok is false if this tree is empty, or the removal is vetoed by a HookBefore hook.
+// This operation is thread safe, concurrent PopMin never return the same key.
+func (t *ART) PopMin() ([]byte, interface{}, bool) {
+	return t.pop(false)
+}
+
+// PopMax remove the maximal key from this tree, and return the key and it's value.
+// ok is false if this tree is empty, or the removal is vetoed by a HookBefore hook.
+// This operation is thread safe, concurrent PopMax never return the same key.
+func (t *ART) PopMax() ([]byte, interface{}, bool) {
+	return t.pop(true)
+}
+
+func (t *ART) pop(maximal bool) ([]byte, interface{}, bool) {
+	path := new(pathCache)
+	g := t.guard(nil, nil)
 	for {
+		path.entries = path.entries[:0]
 		n := (*node)(atomic.LoadPointer(&t.root))
-		if k, v, ok := n.minimalOpt(nil, 0); ok {
-			return k, v
+		k, v, ex, ok := n.popOpt(maximal, &t.root, path, g)
+		t.notifyExpired(g)
+		if ok {
+			if ex {
+				t.notify(EventDelete, k, v, nil, true)
+			}
+			return k, v, ex
 		}
 	}
 }
 
-// Max return the maximal key and it's value in this tree.
-// This operation is thread safe.
-func (t *ART) Max() ([]byte, interface{}) {
+// prefixBound return the minimal or maximal key having the given prefix, ex is false if there is no such key.
+func (t *ART) prefixBound(prefix []byte, maximal bool) ([]byte, interface{}, bool) {
+	return t.unexpired(func() ([]byte, interface{}, bool) {
+		for {
+			n := (*node)(atomic.LoadPointer(&t.root))
+			if k, v, ex, ok := n.prefixBoundOpt(prefix, maximal); ok {
+				return k, v, ex
+			}
+		}
+	})
+}
+
+// iterate run the iterator until it finish, or the context of iterator is done.
+func (t *ART) iterate(it *iterator) error {
+	it.now = t.now()
+	endCmp := 0
+	if it.unbounded {
+		endCmp = -1
+	}
 	for {
 		n := (*node)(atomic.LoadPointer(&t.root))
-		if k, v, ok := n.maximalOpt(nil, 0); ok {
-			return k, v
+		if _, ok := n.iterOpt(it, 0, nil, 0, 0, endCmp); ok {
+			return it.err
+		}
+		if it.ctx != nil {
+			if err := it.ctx.Err(); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -0,0 +1,151 @@
+package art
+
+import (
+	"bytes"
+	"sort"
+	"sync/atomic"
+	"unsafe"
+)
+
+// pathCache record inner nodes visited by the last operation of a batch.
+// Following operation on a key sharing common prefix with the last key can start from the
+// deepest shared node instead of root. A node whose version is unchanged is still at the same
+// position of tree, so it is safe to resume from it as long as its parent's version is checked.
+type pathCache struct {
+	entries []pathEntry
+}
+
+type pathEntry struct {
+	n       *node
+	version uint64
+	depth   int
+	nodeLoc *unsafe.Pointer
+}
+
+func (p *pathCache) push(n *node, version uint64, depth int, nodeLoc *unsafe.Pointer) {
+	if p == nil {
+		return
+	}
+	p.entries = append(p.entries, pathEntry{n: n, version: version, depth: depth, nodeLoc: nodeLoc})
+}
+
+// validate check all recorded nodes except the last skip ones are not modified.
+func (p *pathCache) validate(skip int) bool {
+	for i := 0; i < len(p.entries)-skip; i++ {
+		if !p.entries[i].n.rUnlock(p.entries[i].version) {
+			return false
+		}
+	}
+	return true
+}
+
+// seek return index of the deepest recorded node which is also on the path of a key
+// sharing commonLen bytes with the last key.
+func (p *pathCache) seek(commonLen int) int {
+	for i := len(p.entries) - 1; i > 0; i-- {
+		if p.entries[i].depth <= commonLen {
+			return i
+		}
+	}
+	return 0
+}
+
+// batchOp apply operation on keys[idx] starting from node n.
+type batchOp func(idx int, n *node, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer, path *pathCache) bool
+
+// PutBatch put all given keys and values into this tree, values[i] is the value of keys[i].
+// Keys are applied in sorted order and consecutive keys reuse the descent through their common
+// ancestors. If the same key appear more than once, the last one wins.
+// This operation is thread safe, but the batch is not atomic.
+func (t *ART) PutBatch(keys [][]byte, values []interface{}) {
+	if len(keys) != len(values) {
+		panic("opt-art: keys and values have different length")
+	}
+	t.batch(keys, func(idx int, n *node, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer, path *pathCache) bool {
+		g := t.guard(keys[idx], values[idx])
+		old, replaced, ok := n.insertOpt(keys[idx], values[idx], depth, parent, parentVersion, nodeLoc, path, g)
+		if ok && g.vetoed() == nil {
+			t.notifyExpired(g)
+			t.notify(EventPut, keys[idx], old, values[idx], replaced)
+		}
+		return ok
+	})
+}
+
+// GetBatch lookup all given keys in this tree, values[i] and exists[i] is the result of keys[i].
+// This operation is thread safe, but the batch is not a consistent snapshot.
+func (t *ART) GetBatch(keys [][]byte) (values []interface{}, exists []bool) {
+	values, exists = make([]interface{}, len(keys)), make([]bool, len(keys))
+	now := t.now()
+	t.batch(keys, func(idx int, n *node, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer, path *pathCache) bool {
+		value, _, ex, ok := n.searchOpt(keys[idx], depth, parent, parentVersion, path, now)
+		values[idx], exists[idx] = value, ex
+		return ok
+	})
+	return
+}
+
+// DeleteBatch delete all given keys and their values from this tree.
+// This operation is thread safe, but the batch is not atomic.
+func (t *ART) DeleteBatch(keys [][]byte) {
+	t.batch(keys, func(idx int, n *node, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer, path *pathCache) bool {
+		g := t.guard(keys[idx], nil)
+		old, removed, ok := n.removeOpt(keys[idx], depth, parent, parentVersion, nodeLoc, path, g)
+		if ok {
+			t.notifyExpired(g)
+		}
+		if ok && removed && g.vetoed() == nil {
+			t.notify(EventDelete, keys[idx], old, nil, true)
+		}
+		return ok
+	})
+}
+
+func (t *ART) batch(keys [][]byte, op batchOp) {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+
+	path := new(pathCache)
+	var prev []byte
+	for _, idx := range order {
+		key := keys[idx]
+		start := path.seek(commonPrefixLen(prev, key))
+		for {
+			var (
+				n             *node
+				parent        *node
+				parentVersion uint64
+				depth         int
+				nodeLoc       = &t.root
+			)
+			if start == 0 {
+				n = (*node)(atomic.LoadPointer(&t.root))
+			} else {
+				e, p := path.entries[start], path.entries[start-1]
+				n, depth, nodeLoc = e.n, e.depth, e.nodeLoc
+				parent, parentVersion = p.n, p.version
+			}
+			path.entries = path.entries[:start]
+			if op(idx, n, depth, parent, parentVersion, nodeLoc, path) {
+				break
+			}
+			start = 0
+		}
+		prev = key
+	}
+}
+
+func commonPrefixLen(a, b []byte) int {
+	l := min(len(a), len(b))
+	for i := 0; i < l; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return l
+}
@@ -0,0 +1,114 @@
+package art
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchCRUD(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = k
+	}
+
+	art := NewART()
+	art.PutBatch(keys, values)
+	result, exists := art.GetBatch(keys)
+	for i, k := range keys {
+		assert.True(exists[i])
+		assert.Equal(k, result[i])
+	}
+
+	deleted := keys[:len(keys)/2]
+	art.DeleteBatch(deleted)
+	result, exists = art.GetBatch(keys)
+	for i, k := range keys {
+		if i < len(deleted) {
+			assert.False(exists[i])
+			assert.Nil(result[i])
+		} else {
+			assert.True(exists[i])
+			assert.Equal(k, result[i])
+		}
+	}
+}
+
+func TestPutBatchDuplicateKey(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	art.PutBatch(
+		[][]byte{[]byte("abc"), []byte("ab"), []byte("abc"), []byte("abcdefghijklmn"), []byte("abc")},
+		[]interface{}{1, 2, 3, 4, 5},
+	)
+
+	result, exists := art.GetBatch([][]byte{[]byte("abc"), []byte("ab"), []byte("a"), []byte("abcdefghijklmn")})
+	assert.Equal([]interface{}{5, 2, nil, 4}, result)
+	assert.Equal([]bool{true, true, false, true}, exists)
+}
+
+func TestConcurrentBatch(t *testing.T) {
+	assert := assert.New(t)
+	words := loadTestData("words.txt", nil)
+	sz := runtime.GOMAXPROCS(0)
+	art := NewART()
+
+	var wg sync.WaitGroup
+	for i := 0; i < sz; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var keys [][]byte
+			var values []interface{}
+			for j := i; j < len(words); j += sz {
+				keys = append(keys, words[j])
+				values = append(values, words[j])
+				if len(keys) == 1000 {
+					art.PutBatch(keys, values)
+					keys, values = keys[:0], values[:0]
+				}
+			}
+			art.PutBatch(keys, values)
+		}(i)
+	}
+	wg.Wait()
+
+	result, exists := art.GetBatch(words)
+	for i, k := range words {
+		assert.True(exists[i])
+		assert.Equal(k, result[i])
+	}
+}
+
+func BenchmarkPutBatchUUID(b *testing.B) {
+	data := loadTestData("uuid.txt", b)
+	values := make([]interface{}, len(data))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		art := NewART()
+		for j := 0; j < len(data); j += 1000 {
+			e := min(j+1000, len(data))
+			art.PutBatch(data[j:e], values[j:e])
+		}
+	}
+}
+
+func BenchmarkGetBatchWords(b *testing.B) {
+	art := NewART()
+	data := loadTestData("words.txt", b)
+	for _, d := range data {
+		art.Put(d, d)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(data); j += 1000 {
+			art.GetBatch(data[j:min(j+1000, len(data))])
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package art
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// GetContext is same as Get, but it stop retrying and return ctx.Err() once ctx is done.
+// This operation is thread safe.
+func (t *ART) GetContext(ctx context.Context, key []byte) (interface{}, bool, error) {
+	now := t.now()
+	for {
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if value, _, ex, ok := n.searchOpt(key, 0, nil, 0, nil, now); ok {
+			return value, ex, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// PutContext is same as Put, but it stop retrying and return ctx.Err() once ctx is done.
+// It also return the error of a HookBefore hook vetoing the put.
+// The tree is not modified if an error is returned.
+// This operation is thread safe.
+func (t *ART) PutContext(ctx context.Context, key []byte, value interface{}) error {
+	g := t.guard(key, value)
+	for {
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if old, replaced, ok := n.insertOpt(key, value, 0, nil, 0, &t.root, nil, g); ok {
+			if err := g.vetoed(); err != nil {
+				return err
+			}
+			t.notifyExpired(g)
+			t.notify(EventPut, key, old, value, replaced)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteContext is same as Delete, but it stop retrying and return ctx.Err() once ctx is done.
+// It also return the error of a HookBefore hook vetoing the delete.
+// The tree is not modified if an error is returned.
+// This operation is thread safe.
+func (t *ART) DeleteContext(ctx context.Context, key []byte) error {
+	g := t.guard(key, nil)
+	for {
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if old, removed, ok := n.removeOpt(key, 0, nil, 0, &t.root, nil, g); ok {
+			if err := g.vetoed(); err != nil {
+				return err
+			}
+			t.notifyExpired(g)
+			if removed {
+				t.notify(EventDelete, key, old, nil, true)
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// PrefixContext is same as Prefix, but it stop iterating and return ctx.Err() once ctx is done.
+// This operation is thread safe.
+func (t *ART) PrefixContext(ctx context.Context, prefix []byte, f OpFunc) error {
+	end, bounded := prefixSuccessor(prefix)
+	it := &iterator{
+		end:          end,
+		begin:        prefix,
+		includeBegin: true,
+		unbounded:    !bounded,
+		ctx:          ctx,
+		f:            f,
+	}
+	return t.iterate(it)
+}
+
+// RangeContext is same as Range, but it stop iterating and return ctx.Err() once ctx is done.
+// The context is checked periodically during iteration and between restarts caused by conflicts.
+// This operation is thread safe.
+func (t *ART) RangeContext(ctx context.Context, begin, end []byte, includeBegin, includeEnd bool, f OpFunc) error {
+	it := &iterator{
+		end:          end,
+		begin:        begin,
+		includeBegin: includeBegin,
+		includeEnd:   includeEnd,
+		ctx:          ctx,
+		f:            f,
+	}
+	return t.iterate(it)
+}
+
+// RangeTopContext is same as RangeTop, but it stop iterating and return ctx.Err() once ctx is done.
+// This operation is thread safe.
+func (t *ART) RangeTopContext(ctx context.Context, k int, begin, end []byte, includeBegin, includeEnd bool, f OpFunc) error {
+	it := &iterator{
+		end:          end,
+		begin:        begin,
+		includeBegin: includeBegin,
+		includeEnd:   includeEnd,
+		k:            k,
+		ctx:          ctx,
+	}
+	it.setTopKOp(f)
+	return t.iterate(it)
+}
@@ -0,0 +1,77 @@
+package art
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeContextCancel(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err := art.PrefixContext(ctx, nil, func(key []byte, value interface{}) bool {
+		count++
+		if count == 1000 {
+			cancel()
+		}
+		return false
+	})
+	assert.Equal(context.Canceled, err)
+	assert.True(count >= 1000 && count < 1000+ctxCheckInterval)
+
+	count = 0
+	err = art.RangeContext(context.Background(), keys[0], keys[0], true, true, func(key []byte, value interface{}) bool {
+		count++
+		return false
+	})
+	assert.Nil(err)
+	assert.Equal(1, count)
+
+	count = 0
+	err = art.RangeTopContext(ctx, 10, []byte("a"), []byte("b"), true, false, func(key []byte, value interface{}) bool {
+		count++
+		return false
+	})
+	assert.Nil(err)
+	assert.Equal(10, count)
+}
+
+func TestOperationContext(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	ctx := context.Background()
+
+	assert.Nil(art.PutContext(ctx, []byte("hello"), "world"))
+	v, ok, err := art.GetContext(ctx, []byte("hello"))
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal("world", v)
+
+	assert.Nil(art.DeleteContext(ctx, []byte("hello")))
+	_, ok, err = art.GetContext(ctx, []byte("hello"))
+	assert.Nil(err)
+	assert.False(ok)
+
+	// Mark the root obsolete to make every operation restart.
+	root := (*node)(art.root)
+	atomic.AddUint64(&root.version, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(context.Canceled, art.PutContext(ctx, []byte("hello"), "world"))
+	assert.Equal(context.Canceled, art.DeleteContext(ctx, []byte("hello")))
+	_, _, err = art.GetContext(ctx, []byte("hello"))
+	assert.Equal(context.Canceled, err)
+	assert.Equal(context.Canceled, art.RangeContext(ctx, []byte("a"), []byte("z"), true, true, func([]byte, interface{}) bool {
+		return false
+	}))
+	atomic.AddUint64(&root.version, ^uint64(0))
+}
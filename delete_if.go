@@ -0,0 +1,443 @@
+package art
+
+import (
+	"bytes"
+	"sync/atomic"
+	"unsafe"
+)
+
+// DeleteIf delete all keys in [begin, end) which pred return true, and return the number of deleted keys.
+// If end is nil, the range has no upper bound.
+// Matching keys under the same inner node are removed together, each affected node is locked once,
+// and nodes become too small are rebuilt together with their parent.
+// This operation is thread safe, but the deletion is not atomic. pred must not modify this tree, and
+// it may be called more than once on a key if there are conflicting concurrent updates.
+// Keys whose deletion is vetoed by a HookBefore hook are kept, and expired keys are left to the sweeper.
+func (t *ART) DeleteIf(begin, end []byte, pred func(key []byte, value interface{}) bool) int {
+	d := &deleter{
+		estimator: estimator{begin: begin, end: end},
+		pred:      pred,
+		t:         t,
+		observed:  t.observed(),
+		g:         t.guard(nil, nil),
+		now:       t.now(),
+	}
+	for {
+		d.path = d.path[:0]
+		d.pending = 0
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if d.deleteIfOpt(n, &t.root) {
+			return d.count
+		}
+		if d.resume {
+			// Keys before the successor of final are already done, don't call pred on them again.
+			d.begin = append(d.final[:len(d.final):len(d.final)], 0)
+		}
+	}
+}
+
+// Retain is the opposite of DeleteIf, it delete all keys in [begin, end) which pred return false.
+// This operation is thread safe.
+func (t *ART) Retain(begin, end []byte, pred func(key []byte, value interface{}) bool) int {
+	return t.DeleteIf(begin, end, func(key []byte, value interface{}) bool {
+		return !pred(key, value)
+	})
+}
+
+type deleter struct {
+	estimator
+	pred  func(key []byte, value interface{}) bool
+	count int
+
+	// observed means deleted keys are recorded in plans and reported to watchers.
+	t        *ART
+	observed bool
+
+	// g run before hooks of deleted keys, keys vetoed by them are recorded in vetoed and kept.
+	g      *guard
+	vetoed map[string]struct{}
+	// now is the time keys are checked for expiration, expired keys are not passed to pred.
+	now int64
+
+	// pending is the number of matched keys which are not deleted yet.
+	pending int
+	// last is the last key passed to pred.
+	last []byte
+	// final is the last key which will not be passed to pred again, all keys before it are
+	// either deleted or retained. resume is false if there is no such key.
+	final  []byte
+	resume bool
+}
+
+func (d *deleter) done(key []byte) {
+	if key == nil {
+		key = []byte{}
+	}
+	d.last = key
+	if d.pending == 0 {
+		d.final, d.resume = key, true
+	}
+}
+
+// deletePlan is the pending change of an inner node, which is applied while the node is locked.
+type deletePlan struct {
+	n       *node
+	version uint64
+
+	// entries is the content of n after deletion, children in subs are not rebuilt yet.
+	entries nodeEntries
+	// removed is the keys of children should be removed from n.
+	removed          []byte
+	removePrefixLeaf bool
+	// subs is the children too small to keep, they are rebuilt when n is locked.
+	subs    []*deletePlan
+	subKeys []byte
+
+	// compress is the inner child which will be merged into it's parent instead of n, or nil.
+	compress *node
+
+	// count is the number of deleted keys in this subtree, and deleted is these keys if they
+	// are observed.
+	count   int
+	deleted []KV
+}
+
+// isValid check whether n is still a valid node of it's type with the remaining entries.
+func (p *deletePlan) isValid(isRoot bool) bool {
+	num := len(p.entries.children)
+	switch p.n.nodeType {
+	case typeNode4:
+		if isRoot {
+			return true
+		}
+		if p.entries.prefixLeaf == nil {
+			return num >= 2
+		}
+		return num >= 1
+	case typeNode16:
+		return num >= node16MinSize
+	case typeNode48:
+		return num >= node48MinSize
+	default:
+		return num >= node256MinSize
+	}
+}
+
+// lock lock all nodes will be rebuilt under this plan, and the inner child will be merged into
+// a rebuilt node. Locked nodes are recorded in locked.
+func (p *deletePlan) lock(locked []*node) ([]*node, bool) {
+	for _, sub := range p.subs {
+		if !sub.n.upgradeToLock(sub.version) {
+			return locked, false
+		}
+		locked = append(locked, sub.n)
+
+		e := &sub.entries
+		if len(e.children) == 1 && e.prefixLeaf == nil && sub.subFor(e.keys[0]) == nil {
+			if c := (*node)(e.children[0]); c.nodeType != typeLeaf {
+				// The parent of c is locked, so c cannot be replaced, just wait for other writers.
+				if !c.lock() {
+					return locked, false
+				}
+				locked = append(locked, c)
+				sub.compress = c
+			}
+		}
+
+		var ok bool
+		if locked, ok = sub.lock(locked); !ok {
+			return locked, false
+		}
+	}
+	return locked, true
+}
+
+func (p *deletePlan) subFor(key byte) *deletePlan {
+	for i, k := range p.subKeys {
+		if k == key {
+			return p.subs[i]
+		}
+	}
+	return nil
+}
+
+// release unlock all nodes locked by lock after the plan is applied, rebuilt nodes are obsolete.
+func (p *deletePlan) release() {
+	for _, sub := range p.subs {
+		sub.release()
+		sub.n.unlockObsolete()
+	}
+	if p.compress != nil {
+		p.compress.unlock()
+	}
+}
+
+// rebuildSubs replace children in subs with the rebuilt ones.
+func (p *deletePlan) rebuildSubs() {
+	for i, sub := range p.subs {
+		child := sub.build()
+		if child == nil {
+			continue
+		}
+		for j, k := range p.entries.keys {
+			if k == p.subKeys[i] {
+				p.entries.children[j] = child
+				break
+			}
+		}
+	}
+}
+
+// build create the smallest subtree holding the remaining entries of a locked plan,
+// it may return a leaf or a compressed child if there is only one entry, or nil if there is nothing.
+func (p *deletePlan) build() unsafe.Pointer {
+	p.rebuildSubs()
+	e := &p.entries
+	switch {
+	case len(e.children) == 0:
+		return e.prefixLeaf
+	case len(e.children) == 1 && e.prefixLeaf == nil:
+		child := (*node)(e.children[0])
+		if child.nodeType != typeLeaf {
+			// p.n is locked and replaced by child, so it's prefix can be changed.
+			p.n.mergePrefix(e.keys[0], child)
+		}
+		return unsafe.Pointer(child)
+	}
+	newNode := e.buildNode(nil, 0, 0)
+	newNode.prefix = p.n.prefix
+	newNode.prefixLen = p.n.prefixLen
+	return unsafe.Pointer(newNode)
+}
+
+// apply lock n and apply the plan to it. If n is the root and too small to keep, a new root is
+// stored to nodeLoc. Before hooks in g are run on deleted keys once all nodes are locked, and
+// nothing is changed if any of them is vetoed.
+func (p *deletePlan) apply(nodeLoc *unsafe.Pointer, g *guard) bool {
+	n := p.n
+	if !n.upgradeToLock(p.version) {
+		return false
+	}
+	locked, ok := p.lock(nil)
+	if ok {
+		for _, kv := range p.deleted {
+			if ok = g.deleteKey(kv.Key, kv.Value); !ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].unlock()
+		}
+		n.unlock()
+		return false
+	}
+
+	if !p.isValid(true) {
+		p.rebuildSubs()
+		atomic.StorePointer(nodeLoc, unsafe.Pointer(p.entries.buildNode(nil, 0, 0)))
+		p.release()
+		n.unlockObsolete()
+		return true
+	}
+
+	for i, sub := range p.subs {
+		if child := sub.build(); child != nil {
+			_, loc, _ := n.findChild(p.subKeys[i])
+			atomic.StorePointer(loc, child)
+		}
+	}
+	for _, k := range p.removed {
+		_, _, pos := n.findChild(k)
+		n.removeChild(pos)
+	}
+	if p.removePrefixLeaf {
+		atomic.StorePointer(&n.prefixLeaf, nil)
+	}
+	p.release()
+	n.unlock()
+	return true
+}
+
+// deleteIfOpt delete matching keys in the tree whose root is n.
+func (d *deleter) deleteIfOpt(n *node, nodeLoc *unsafe.Pointer) bool {
+	p, ok := d.planOpt(n, 0, nil, 0, true, d.end != nil)
+	if !ok {
+		return false
+	}
+	if p == nil {
+		return true
+	}
+	if !d.apply(p, nodeLoc) {
+		return false
+	}
+	d.applied(p)
+	return true
+}
+
+// apply apply p, and record the key vetoed by before hooks if it's not applied because of them.
+func (d *deleter) apply(p *deletePlan, nodeLoc *unsafe.Pointer) bool {
+	if p.apply(nodeLoc, d.g) {
+		return true
+	}
+	if d.g.vetoed() != nil {
+		if d.vetoed == nil {
+			d.vetoed = make(map[string]struct{})
+		}
+		d.vetoed[string(d.g.key)] = struct{}{}
+		d.g.err = nil
+	}
+	return false
+}
+
+// match return true if the key of l should be deleted.
+func (d *deleter) match(l *leaf, key []byte, value interface{}) bool {
+	if l.expired(d.now) {
+		return false
+	}
+	if _, ok := d.vetoed[string(key)]; ok {
+		return false
+	}
+	return d.pred(key, value)
+}
+
+// remove record a matched key in p.
+func (d *deleter) remove(p *deletePlan, key []byte, value interface{}) {
+	p.count++
+	d.pending++
+	if d.observed {
+		p.deleted = append(p.deleted, KV{Key: key, Value: value})
+	}
+}
+
+func (d *deleter) applied(p *deletePlan) {
+	d.count += p.count
+	d.pending -= p.count
+	for _, kv := range p.deleted {
+		d.t.notify(EventDelete, kv.Key, kv.Value, nil, true)
+	}
+	if d.pending == 0 && d.last != nil {
+		d.final, d.resume = d.last, true
+	}
+}
+
+// planOpt find matching keys in subtree n, and apply the deletion if n is still valid after it.
+// Otherwise the plan is returned and applied by the caller.
+func (d *deleter) planOpt(n *node, depth int, parent *node, parentVersion uint64, onBegin, onEnd bool) (*deletePlan, bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return nil, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return nil, false
+	}
+
+	if d.path, ok = n.appendPrefix(d.path, version, depth); !ok {
+		return nil, false
+	}
+	depth += n.prefixLen
+
+	if onBegin {
+		l := min(depth, len(d.begin))
+		cmp := bytes.Compare(d.path[:l], d.begin[:l])
+		if cmp < 0 {
+			return nil, n.rUnlock(version)
+		}
+		onBegin = cmp == 0 && len(d.begin) > depth
+	}
+	if onEnd {
+		l := min(depth, len(d.end))
+		cmp := bytes.Compare(d.path[:l], d.end[:l])
+		if cmp > 0 || (cmp == 0 && len(d.end) <= depth) {
+			return nil, n.rUnlock(version)
+		}
+		onEnd = cmp == 0
+	}
+
+	p := &deletePlan{n: n, version: version}
+	if l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf)); l != nil {
+		k, v := l.key, l.value
+		if !n.lockCheck(version) {
+			return nil, false
+		}
+		if !onBegin && d.match(l, k, v) {
+			p.removePrefixLeaf = true
+			d.remove(p, k, v)
+		} else {
+			p.entries.prefixLeaf = unsafe.Pointer(l)
+		}
+		if !onBegin {
+			d.done(k)
+		}
+	}
+
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return nil, false
+		}
+		if child == nil {
+			break
+		}
+		next = int(key) + 1
+
+		inRange := !(onBegin && key < d.begin[depth]) && !(onEnd && key > d.end[depth])
+		if !inRange {
+			p.entries.add(key, unsafe.Pointer(child))
+			continue
+		}
+
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, v := l.key, l.value
+			if !n.lockCheck(version) {
+				return nil, false
+			}
+			if (onBegin || onEnd) && !d.contains(k) {
+				p.entries.add(key, unsafe.Pointer(child))
+				continue
+			}
+			if d.match(l, k, v) {
+				p.removed = append(p.removed, key)
+				d.remove(p, k, v)
+			} else {
+				p.entries.add(key, unsafe.Pointer(child))
+			}
+			d.done(k)
+			continue
+		}
+
+		d.path = append(d.path[:depth], key)
+		sub, ok := d.planOpt(child, depth+1, n, version, onBegin && key == d.begin[depth], onEnd && key == d.end[depth])
+		if !ok {
+			return nil, false
+		}
+		if sub == nil {
+			p.entries.add(key, unsafe.Pointer(child))
+			continue
+		}
+		p.subs = append(p.subs, sub)
+		p.subKeys = append(p.subKeys, key)
+		p.count += sub.count
+		p.deleted = append(p.deleted, sub.deleted...)
+		if len(sub.entries.children) == 0 && sub.entries.prefixLeaf == nil {
+			p.removed = append(p.removed, key)
+		} else {
+			p.entries.add(key, unsafe.Pointer(child))
+		}
+	}
+
+	if p.count == 0 {
+		return nil, n.rUnlock(version)
+	}
+	if parent == nil || !p.isValid(false) {
+		// Let the caller apply the root, and parent rebuild this node.
+		return p, true
+	}
+	if !d.apply(p, nil) {
+		return nil, false
+	}
+	d.applied(p)
+	return nil, true
+}
@@ -0,0 +1,115 @@
+package art
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteIf(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	art.Put(nil, nil)
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	b, e := len(keys)/10, len(keys)/10*9
+	var expected [][]byte
+	for i, k := range keys {
+		if i < b || i >= e || len(k)%3 == 0 {
+			expected = append(expected, k)
+		}
+	}
+	count := art.DeleteIf(keys[b], keys[e], func(key []byte, value interface{}) bool {
+		assert.True(bytes.Compare(key, keys[b]) >= 0 && bytes.Compare(key, keys[e]) < 0)
+		return len(key)%3 != 0
+	})
+	assert.Equal(len(keys)-len(expected), count)
+	// The first key is the empty key.
+	assert.Equal(expected, collectKeys(art)[1:])
+
+	count = art.Retain(nil, nil, func(key []byte, value interface{}) bool {
+		return len(key) > 0 && key[0] == 'a'
+	})
+	assert.Equal(len(expected)+1, count+len(collectKeys(art)))
+	art.Prefix(nil, func(key []byte, value interface{}) bool {
+		assert.Equal(byte('a'), key[0])
+		return false
+	})
+
+	assert.Equal(0, art.DeleteIf([]byte("b"), nil, func(key []byte, value interface{}) bool {
+		assert.Fail("unexpected key", "%s", key)
+		return true
+	}))
+	art.DeleteIf(nil, nil, func(key []byte, value interface{}) bool {
+		return true
+	})
+	_, _, ok := art.Min()
+	assert.False(ok)
+}
+
+func TestDeleteIfLongPrefix(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	var keys [][]byte
+	for i := 0; i < 1000; i++ {
+		k := []byte(fmt.Sprintf("%s%03d%s", "commonlongprefix"[:i%17], i%31, "suffix"[:i%7]))
+		keys = append(keys, k)
+		art.Put(k, k)
+	}
+
+	count := art.DeleteIf(nil, nil, func(key []byte, value interface{}) bool {
+		return key[len(key)-1]%3 != 0
+	})
+	for _, k := range keys {
+		v, ok := art.Get(k)
+		if k[len(k)-1]%3 != 0 {
+			assert.False(ok)
+			continue
+		}
+		assert.True(ok)
+		assert.Equal(k, v)
+	}
+	assert.Equal(len(sortedKeys(keys)), len(collectKeys(art))+count)
+}
+
+func TestConcurrentDeleteIf(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(keys); j += 4 {
+				if j%2 == 0 {
+					art.Put(append(keys[j][:len(keys[j]):len(keys[j])], '!'), nil)
+				} else {
+					art.Get(keys[j])
+				}
+			}
+		}(i)
+	}
+	count := art.DeleteIf(nil, nil, func(key []byte, value interface{}) bool {
+		return value != nil
+	})
+	wg.Wait()
+
+	assert.Equal(len(keys), count)
+	for j, k := range keys {
+		_, ok := art.Get(k)
+		assert.False(ok)
+		_, ok = art.Get(append(k[:len(k):len(k)], '!'))
+		assert.Equal(j%2 == 0, ok)
+	}
+}
@@ -0,0 +1,53 @@
+package art
+
+import "reflect"
+
+// ChangeKind is the kind of difference of a key reported by Diff.
+type ChangeKind int
+
+const (
+	// Inserted means the key only exists in the new tree.
+	Inserted ChangeKind = iota
+	// Deleted means the key only exists in the old tree.
+	Deleted
+	// Changed means the key exists in both trees with different values.
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Inserted:
+		return "Inserted"
+	case Deleted:
+		return "Deleted"
+	case Changed:
+		return "Changed"
+	default:
+		return "Unknown"
+	}
+}
+
+// Diff call f with keys inserted, deleted or changed from a to b in ascending order until f return true.
+// old is the value in a and new is the value in b, the missing one is nil. Values are compared by
+// reflect.DeepEqual. Subtrees shared by both trees are skipped by pointer equality without visiting
+// their keys, and other subtrees are compared by their prefix and children.
+// This operation is thread safe, but the result is not a snapshot if a or b is changed during it.
+func Diff(a, b *ART, f func(key []byte, old, new interface{}, kind ChangeKind) bool) {
+	w := &pairWalker{
+		visitA:   true,
+		visitB:   true,
+		skipSame: true,
+		f: func(key []byte, va, vb interface{}, inA, inB bool) bool {
+			switch {
+			case !inA:
+				return f(key, nil, vb, Inserted)
+			case !inB:
+				return f(key, va, nil, Deleted)
+			case !reflect.DeepEqual(va, vb):
+				return f(key, va, vb, Changed)
+			}
+			return false
+		},
+	}
+	w.walk(a, b)
+}
@@ -0,0 +1,124 @@
+package art
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type diffResult struct {
+	key      string
+	old, new interface{}
+	kind     ChangeKind
+}
+
+func collectDiff(a, b *ART) []diffResult {
+	var result []diffResult
+	Diff(a, b, func(key []byte, old, new interface{}, kind ChangeKind) bool {
+		result = append(result, diffResult{key: string(key), old: old, new: new, kind: kind})
+		return false
+	})
+	return result
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	a, b := NewART(), NewART()
+	a.Put(nil, 0)
+	var expected []diffResult
+	expected = append(expected, diffResult{key: "", old: 0, kind: Deleted})
+	for i, k := range keys {
+		switch i % 7 {
+		case 0:
+			a.Put(k, i)
+			expected = append(expected, diffResult{key: string(k), old: i, kind: Deleted})
+		case 1:
+			b.Put(k, i)
+			expected = append(expected, diffResult{key: string(k), new: i, kind: Inserted})
+		case 2:
+			a.Put(k, []byte{1})
+			b.Put(k, []byte{2})
+			expected = append(expected, diffResult{key: string(k), old: []byte{1}, new: []byte{2}, kind: Changed})
+		default:
+			a.Put(k, []byte{1})
+			b.Put(k, []byte{1})
+		}
+	}
+	assert.Equal(expected, collectDiff(a, b))
+
+	for i := range expected {
+		e := &expected[i]
+		e.old, e.new = e.new, e.old
+		if e.kind != Changed {
+			e.kind = 1 - e.kind
+		}
+	}
+	assert.Equal(expected, collectDiff(b, a))
+
+	assert.Empty(collectDiff(a, a))
+	assert.Empty(collectDiff(NewART(), NewART()))
+	assert.Len(collectDiff(NewART(), a), len(collectKeys(a)))
+
+	count := 0
+	Diff(a, b, func(key []byte, old, new interface{}, kind ChangeKind) bool {
+		count++
+		return count == 10
+	})
+	assert.Equal(10, count)
+}
+
+func TestDiffPrefix(t *testing.T) {
+	assert := assert.New(t)
+	a := newARTWithKeys("a", "ab", "abcdefghijklmnopq1", "abcdefghijklmnopq2", "b")
+	b := newARTWithKeys("ab", "abcdefghijklmnopq2", "abcdefghijklmnopq3", "abcdefghijklmnopr", "c")
+	b.Put([]byte("ab"), "changed")
+	assert.Equal([]diffResult{
+		{key: "a", old: "a", kind: Deleted},
+		{key: "ab", old: "ab", new: "changed", kind: Changed},
+		{key: "abcdefghijklmnopq1", old: "abcdefghijklmnopq1", kind: Deleted},
+		{key: "abcdefghijklmnopq3", new: "abcdefghijklmnopq3", kind: Inserted},
+		{key: "abcdefghijklmnopr", new: "abcdefghijklmnopr", kind: Inserted},
+		{key: "b", old: "b", kind: Deleted},
+		{key: "c", new: "c", kind: Inserted},
+	}, collectDiff(a, b))
+	assert.Equal("Changed", Changed.String())
+}
+
+func TestConcurrentDiff(t *testing.T) {
+	assert := assert.New(t)
+	a, b := NewART(), NewART()
+	for i := 0; i < 10000; i++ {
+		a.Put([]byte(fmt.Sprintf("%05d", i)), i)
+		if i%2 == 0 {
+			b.Put([]byte(fmt.Sprintf("%05d", i)), i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10000; i++ {
+			k := []byte(fmt.Sprintf("%05dx", i))
+			b.Put(k, nil)
+			b.Delete(k)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		var prev string
+		count := 0
+		Diff(a, b, func(key []byte, old, new interface{}, kind ChangeKind) bool {
+			assert.True(prev < string(key) || (prev == "" && count == 0))
+			prev = string(key)
+			if kind == Deleted {
+				count++
+			}
+			return false
+		})
+		assert.Equal(5000, count)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,189 @@
+package art
+
+import (
+	"bytes"
+	"math"
+	"sync/atomic"
+	"unsafe"
+)
+
+// DistinctPrefixes call f with each distinct prefix of length prefixLen of keys in this tree in
+// ascending order until f return true, keys shorter than prefixLen are ignored.
+// Once a prefix is found, the rest of keys having it are skipped by moving to the next sibling of
+// the subtree, instead of visiting every leaf.
+// This operation is thread safe, and f may modify this tree as OpFunc does.
+func (t *ART) DistinctPrefixes(prefixLen int, f func(prefix []byte) bool) {
+	if prefixLen <= 0 {
+		if _, _, ok := t.Min(); ok {
+			f([]byte{})
+		}
+		return
+	}
+	it := &distinctIterator{
+		n: prefixLen,
+		f: func(prefix []byte, _ int) bool {
+			return f(prefix)
+		},
+	}
+	t.iterateDistinct(it)
+}
+
+// PrefixCounts return the number of keys under each distinct extension of prefix by depth bytes,
+// keys shorter than len(prefix)+depth are not counted.
+// Extensions are found by the inner nodes like DistinctPrefixes, and keys under them are counted
+// without reading leaves. This operation is thread safe, but the counts are not a snapshot
+// if there are concurrent updates.
+func (t *ART) PrefixCounts(prefix []byte, depth int) map[string]int {
+	counts := make(map[string]int)
+	it := &distinctIterator{
+		n:      len(prefix) + max(depth, 0),
+		prefix: prefix,
+		count:  true,
+		f: func(prefix []byte, count int) bool {
+			// Only the empty root has no key.
+			if count > 0 {
+				counts[string(prefix)] = count
+			}
+			return false
+		},
+	}
+	t.iterateDistinct(it)
+	return counts
+}
+
+func (t *ART) iterateDistinct(it *distinctIterator) {
+	it.now = t.now()
+	for {
+		it.path = it.path[:0]
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if _, ok := n.distinctOpt(it, 0, nil, 0, it.prev != nil); ok {
+			return
+		}
+	}
+}
+
+type distinctIterator struct {
+	n int
+	// prefix is the prefix of all visited keys.
+	prefix []byte
+	// count means the number of keys under each prefix is passed to f.
+	count bool
+	// prev is the last applied prefix, iterate restart from the prefix after it.
+	prev []byte
+
+	// path is the key bytes from root to the current node.
+	path []byte
+	// now is the time keys are checked for expiration, expired keys are not counted.
+	now int64
+
+	f func(prefix []byte, count int) bool
+}
+
+func (it *distinctIterator) apply(prefix []byte, count int) bool {
+	it.prev = prefix
+	return it.f(prefix, count)
+}
+
+// distinctOpt visit distinct prefixes in subtree n. If onBound is true, n is on the path of
+// it.prev and only prefixes greater than it.prev are visited.
+func (n *node) distinctOpt(it *distinctIterator, depth int, parent *node, parentVersion uint64, onBound bool) (end, ok bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return false, false
+	}
+
+	if it.path, ok = n.appendPrefix(it.path, version, depth); !ok {
+		return false, false
+	}
+	depth += n.prefixLen
+
+	if l := min(depth, len(it.prefix)); !bytes.Equal(it.path[:l], it.prefix[:l]) {
+		return false, n.rUnlock(version)
+	}
+	bound := it.prev
+	if onBound {
+		l := min(depth, it.n)
+		cmp := bytes.Compare(it.path[:l], bound[:l])
+		if cmp < 0 || (cmp == 0 && depth >= it.n) {
+			// The prefix of this subtree is already applied.
+			return false, n.rUnlock(version)
+		}
+		onBound = cmp == 0
+	}
+	if depth >= it.n {
+		// A non-root node always has keys, and the root is never this deep.
+		prefix := append([]byte(nil), it.path[:it.n]...)
+		count := 0
+		switch {
+		case it.now != 0:
+			// Keys of this subtree may be all expired.
+			limit := 1
+			if it.count {
+				limit = math.MaxInt
+			}
+			if count, ok = n.liveSizeOpt(version, it.now, limit); !ok {
+				return false, false
+			}
+			if count == 0 {
+				return false, true
+			}
+		case it.count:
+			// An unlimited budget make the estimation exact.
+			if count, ok = n.estimateSizeOpt(version, math.MaxInt); !ok {
+				return false, false
+			}
+		default:
+			if !n.rUnlock(version) {
+				return false, false
+			}
+		}
+		return it.apply(prefix, count), true
+	}
+
+	// The prefix leaf is shorter than it.n, so only children are visited.
+	from := 0
+	if onBound {
+		from = int(bound[depth])
+	}
+	if depth < len(it.prefix) {
+		from = max(from, int(it.prefix[depth]))
+	}
+	for next := from; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if child == nil || (depth < len(it.prefix) && key > it.prefix[depth]) {
+			break
+		}
+		next = int(key) + 1
+
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, dead := l.key, l.expired(it.now)
+			if !n.lockCheck(version) {
+				return false, false
+			}
+			if dead || len(k) < it.n || !bytes.HasPrefix(k, it.prefix) || (onBound && bytes.Compare(k[:it.n], bound) <= 0) {
+				continue
+			}
+			if it.apply(k[:it.n:it.n], 1) {
+				return true, true
+			}
+			continue
+		}
+
+		it.path = append(it.path[:depth], key)
+		end, ok := child.distinctOpt(it, depth+1, n, version, onBound && key == bound[depth])
+		if !ok {
+			return false, false
+		}
+		if end {
+			return true, true
+		}
+	}
+	return false, n.lockCheck(version)
+}
@@ -0,0 +1,142 @@
+package art
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func distinctPrefixes(keys [][]byte, prefixLen int) [][]byte {
+	var result [][]byte
+	for _, k := range sortedKeys(keys) {
+		if len(k) < prefixLen {
+			continue
+		}
+		if l := len(result); l == 0 || string(result[l-1]) != string(k[:prefixLen]) {
+			result = append(result, k[:prefixLen])
+		}
+	}
+	return result
+}
+
+func TestDistinctPrefixes(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	art.Put(nil, nil)
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	for _, l := range []int{1, 2, 3, 5, 8, 20} {
+		var result [][]byte
+		art.DistinctPrefixes(l, func(prefix []byte) bool {
+			result = append(result, prefix)
+			return false
+		})
+		assert.Equal(distinctPrefixes(keys, l), result, "prefix length %d", l)
+	}
+
+	count := 0
+	art.DistinctPrefixes(0, func(prefix []byte) bool {
+		assert.Empty(prefix)
+		count++
+		return false
+	})
+	assert.Equal(1, count)
+
+	count = 0
+	art.DistinctPrefixes(2, func(prefix []byte) bool {
+		count++
+		return count == 10
+	})
+	assert.Equal(10, count)
+
+	NewART().DistinctPrefixes(0, func(prefix []byte) bool {
+		assert.Fail("unexpected prefix", "%v", prefix)
+		return false
+	})
+}
+
+func TestDistinctPrefixesCompositeKey(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	var keys [][]byte
+	for tenant := 0; tenant < 50; tenant++ {
+		for user := 0; user < 20; user++ {
+			for event := 0; event < tenant%5+1; event++ {
+				k := []byte(fmt.Sprintf("t%04d/u%06d/e%08d", tenant, user, event))
+				keys = append(keys, k)
+				art.Put(k, nil)
+			}
+		}
+	}
+
+	var tenants [][]byte
+	art.DistinctPrefixes(len("t0000/"), func(prefix []byte) bool {
+		tenants = append(tenants, prefix)
+		return false
+	})
+	assert.Equal(distinctPrefixes(keys, len("t0000/")), tenants)
+	assert.Len(tenants, 50)
+
+	// Delete every other tenant while listing them.
+	var result [][]byte
+	art.DistinctPrefixes(len("t0000/u000000/"), func(prefix []byte) bool {
+		result = append(result, prefix)
+		if prefix[4]%2 == 0 {
+			var del [][]byte
+			art.Prefix(prefix[:len("t0000/")], func(key []byte, _ interface{}) bool {
+				del = append(del, key)
+				return false
+			})
+			art.DeleteBatch(del)
+		}
+		return false
+	})
+	var expected [][]byte
+	for _, p := range distinctPrefixes(keys, len("t0000/u000000/")) {
+		// Only the first user of deleted tenants is listed.
+		if p[4]%2 != 0 || string(p[6:13]) == "u000000" {
+			expected = append(expected, p)
+		}
+	}
+	assert.Equal(expected, result)
+
+	var remain [][]byte
+	art.DistinctPrefixes(len("t0000/"), func(prefix []byte) bool {
+		remain = append(remain, prefix)
+		return false
+	})
+	assert.Len(remain, 25)
+}
+
+func TestPrefixCounts(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	art.Put(nil, nil)
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	for _, prefix := range []string{"", "a", "co", "pre", "zzzz"} {
+		for _, depth := range []int{0, 1, 2, 4} {
+			expected := make(map[string]int)
+			for _, k := range keys {
+				if l := len(prefix) + depth; len(k) >= l && string(k[:len(prefix)]) == prefix {
+					expected[string(k[:l])]++
+				}
+			}
+			if prefix == "" && depth == 0 {
+				// The empty key is counted too.
+				expected[""]++
+			}
+			assert.Equal(expected, art.PrefixCounts([]byte(prefix), depth), "prefix %q depth %d", prefix, depth)
+		}
+	}
+
+	assert.Empty(NewART().PrefixCounts(nil, 0))
+	assert.Equal(map[string]int{"a": 1}, newARTWithKeys("a").PrefixCounts(nil, 1))
+}
@@ -0,0 +1,304 @@
+package art
+
+import (
+	"bytes"
+	"sync/atomic"
+	"unsafe"
+)
+
+// estimateDepth is the number of levels whose children are counted exactly by estimation,
+// the size of deeper subtrees is extrapolated from the fan-out along a single path.
+const estimateDepth = 2
+
+// EstimateRange estimate the number of keys in [begin, end) without visiting every leaf.
+// Nodes on the path of begin and end are visited exactly, and the size of subtrees inside
+// the range is estimated from fan-out of inner nodes. If end is nil, the range has no upper bound.
+// This operation is thread safe.
+func (t *ART) EstimateRange(begin, end []byte) int {
+	e := &estimator{begin: begin, end: end}
+	for {
+		e.path = e.path[:0]
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if count, ok := n.estimateRangeOpt(e, 0, nil, 0, true, end != nil); ok {
+			return count
+		}
+	}
+}
+
+// SplitKeys return at most n-1 sorted keys, which split this tree into n parts having
+// approximately same number of keys. The keys may not exist in this tree.
+// This operation is thread safe.
+func (t *ART) SplitKeys(n int) [][]byte {
+	if n < 2 {
+		return nil
+	}
+	for {
+		root := (*node)(atomic.LoadPointer(&t.root))
+		version, ok := root.rLock()
+		if !ok {
+			continue
+		}
+		total, ok := root.estimateSizeOpt(version, estimateDepth)
+		if !ok {
+			continue
+		}
+		s := &splitter{
+			n:    n,
+			step: float64(total) / float64(n),
+		}
+		s.target = s.step
+		if _, ok := root.splitKeysOpt(s, 0, nil, 0); ok {
+			return s.keys
+		}
+	}
+}
+
+type estimator struct {
+	begin []byte
+	end   []byte
+	path  []byte
+}
+
+func (e *estimator) contains(key []byte) bool {
+	return bytes.Compare(key, e.begin) >= 0 && (e.end == nil || bytes.Compare(key, e.end) < 0)
+}
+
+// appendPrefix append the prefix of n to path.
+func (n *node) appendPrefix(path []byte, version uint64, depth int) ([]byte, bool) {
+	if n.prefixLen <= maxPrefixLen {
+		path = append(path, n.prefix[:n.prefixLen]...)
+		return path, n.lockCheck(version)
+	}
+	fullKey, ok := n.fullKey(version)
+	if !ok {
+		return nil, false
+	}
+	return append(path, fullKey[depth:depth+n.prefixLen]...), true
+}
+
+func (n *node) childCount() int {
+	if n.nodeType == typeNode256 && n.numChildren == 0 {
+		return 256
+	}
+	return int(n.numChildren)
+}
+
+func (n *node) estimateRangeOpt(e *estimator, depth int, parent *node, parentVersion uint64, onBegin, onEnd bool) (int, bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return 0, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return 0, false
+	}
+
+	if e.path, ok = n.appendPrefix(e.path, version, depth); !ok {
+		return 0, false
+	}
+	depth += n.prefixLen
+
+	if onBegin {
+		l := min(depth, len(e.begin))
+		cmp := bytes.Compare(e.path[:l], e.begin[:l])
+		if cmp < 0 {
+			return 0, n.rUnlock(version)
+		}
+		onBegin = cmp == 0 && len(e.begin) > depth
+	}
+	if onEnd {
+		l := min(depth, len(e.end))
+		cmp := bytes.Compare(e.path[:l], e.end[:l])
+		if cmp > 0 || (cmp == 0 && len(e.end) <= depth) {
+			return 0, n.rUnlock(version)
+		}
+		onEnd = cmp == 0
+	}
+	if !onBegin && !onEnd {
+		return n.estimateSizeOpt(version, estimateDepth)
+	}
+
+	count := 0
+	if !onBegin && atomic.LoadPointer(&n.prefixLeaf) != nil {
+		count++
+	}
+	from := 0
+	if onBegin {
+		from = int(e.begin[depth])
+	}
+	for next := from; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return 0, false
+		}
+		if child == nil || (onEnd && key > e.end[depth]) {
+			break
+		}
+
+		if child.nodeType == typeLeaf {
+			in := e.contains((*leaf)(unsafe.Pointer(child)).key)
+			if !n.lockCheck(version) {
+				return 0, false
+			}
+			if in {
+				count++
+			}
+		} else {
+			e.path = append(e.path[:depth], key)
+			c, ok := child.estimateRangeOpt(e, depth+1, n, version, onBegin && key == e.begin[depth], onEnd && key == e.end[depth])
+			if !ok {
+				return 0, false
+			}
+			count += c
+		}
+		next = int(key) + 1
+	}
+	return count, n.rUnlock(version)
+}
+
+// estimateSizeOpt estimate the number of keys in subtree n, children in the first budget levels
+// are counted exactly, and deeper subtrees are assumed to be as large as their middle sibling.
+func (n *node) estimateSizeOpt(version uint64, budget int) (int, bool) {
+	count := 0
+	if atomic.LoadPointer(&n.prefixLeaf) != nil {
+		count++
+	}
+
+	if budget == 0 {
+		num := n.childCount()
+		_, child := n.childFrom(128)
+		if child == nil {
+			_, child = n.childFrom(0)
+		}
+		if !n.lockCheck(version) {
+			return 0, false
+		}
+		if child == nil {
+			return count, true
+		}
+		if child.nodeType == typeLeaf {
+			return count + num, true
+		}
+		childVersion, ok := child.rLock()
+		if !ok {
+			return 0, false
+		}
+		sub, ok := child.estimateSizeOpt(childVersion, 0)
+		if !ok {
+			return 0, false
+		}
+		return count + num*sub, n.rUnlock(version)
+	}
+
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return 0, false
+		}
+		if child == nil {
+			break
+		}
+		if child.nodeType == typeLeaf {
+			count++
+		} else {
+			childVersion, ok := child.rLock()
+			if !ok {
+				return 0, false
+			}
+			sub, ok := child.estimateSizeOpt(childVersion, budget-1)
+			if !ok {
+				return 0, false
+			}
+			count += sub
+		}
+		next = int(key) + 1
+	}
+	return count, n.rUnlock(version)
+}
+
+type splitter struct {
+	n    int
+	keys [][]byte
+
+	// acc is the number of keys before the current position.
+	acc    float64
+	step   float64
+	target float64
+}
+
+// add account a key at current position, it return true if enough split keys are found.
+func (s *splitter) add(key []byte) bool {
+	s.acc++
+	for s.acc > s.target && len(s.keys) < s.n-1 {
+		if len(s.keys) == 0 || !bytes.Equal(s.keys[len(s.keys)-1], key) {
+			s.keys = append(s.keys, key)
+		}
+		s.target += s.step
+	}
+	return len(s.keys) == s.n-1
+}
+
+func (n *node) splitKeysOpt(s *splitter, depth int, parent *node, parentVersion uint64) (end, ok bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return false, false
+	}
+
+	depth += n.prefixLen
+
+	if l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf)); l != nil {
+		key := l.key
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if s.add(key) {
+			return true, true
+		}
+	}
+
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if child == nil {
+			break
+		}
+
+		if child.nodeType == typeLeaf {
+			k := (*leaf)(unsafe.Pointer(child)).key
+			if !n.lockCheck(version) {
+				return false, false
+			}
+			if s.add(k) {
+				return true, true
+			}
+		} else {
+			childVersion, ok := child.rLock()
+			if !ok {
+				return false, false
+			}
+			size, ok := child.estimateSizeOpt(childVersion, estimateDepth-1)
+			if !ok {
+				return false, false
+			}
+
+			if s.acc+float64(size) > s.target {
+				// Some split keys are inside this child, find them in the child.
+				end, ok := child.splitKeysOpt(s, depth+1, n, version)
+				if !ok {
+					return false, false
+				}
+				if end {
+					return true, true
+				}
+			} else {
+				s.acc += float64(size)
+			}
+		}
+		next = int(key) + 1
+	}
+	return false, n.rUnlock(version)
+}
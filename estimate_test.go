@@ -0,0 +1,60 @@
+package art
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateRange(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	assertNear := func(except, got int) {
+		assert.True(got >= except/2 && got <= except*2, "except about %d got %d", except, got)
+	}
+	assertNear(len(keys), art.EstimateRange(nil, nil))
+	for _, r := range [][2]int{{0, len(keys) / 2}, {len(keys) / 10, len(keys) / 10 * 9}, {len(keys) / 3, len(keys) / 3 * 2}} {
+		assertNear(r[1]-r[0], art.EstimateRange(keys[r[0]], keys[r[1]]))
+	}
+
+	small := newARTWithKeys("", "a", "ab", "abc", "abcdefghijklmn", "b")
+	assert.Equal(6, small.EstimateRange(nil, nil))
+	assert.Equal(4, small.EstimateRange([]byte("a"), []byte("b")))
+	assert.Equal(2, small.EstimateRange([]byte("abc"), []byte("abd")))
+	assert.Equal(0, small.EstimateRange([]byte("c"), nil))
+	assert.Equal(0, NewART().EstimateRange(nil, nil))
+}
+
+func TestSplitKeys(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	n := 8
+	splits := art.SplitKeys(n)
+	assert.Len(splits, n-1)
+	bounds := append(append([][]byte{nil}, splits...), nil)
+	for i := 0; i < n; i++ {
+		if i > 0 && i < n-1 {
+			assert.True(bytes.Compare(bounds[i], bounds[i+1]) < 0)
+		}
+		count := 0
+		art.ParallelRange(bounds[i], bounds[i+1], 1, func([]byte, interface{}) bool {
+			count++
+			return false
+		})
+		assert.True(count > len(keys)/n/4 && count < len(keys)/n*4, "part %d has %d keys", i, count)
+	}
+
+	assert.Empty(NewART().SplitKeys(4))
+	assert.Equal([][]byte{[]byte("b"), []byte("c")}, newARTWithKeys("a", "b", "c").SplitKeys(3))
+}
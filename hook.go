@@ -0,0 +1,176 @@
+package art
+
+import "sync"
+
+// HookMode decide when a hook is run.
+type HookMode int
+
+const (
+	// HookAfter run the hook after the change is published, and it's error is ignored.
+	// It's run by all operations changing the tree.
+	HookAfter HookMode = iota
+	// HookBefore run the hook with the changed node locked before the change is published,
+	// and a non-nil error cancel the change. It's run by all operations changing the tree,
+	// PutContext and DeleteContext return the error. A vetoed PopMin or PopMax return nothing,
+	// a vetoed Move or MovePrefix move nothing, and DeleteIf keep the vetoed keys.
+	// The hook must not access the tree, and it may be called again if the change is retried
+	// because of conflicts.
+	// Removing keys expired by PutWithTTL is not vetoable, so it only run HookAfter hooks.
+	HookBefore
+)
+
+type putHook struct {
+	mode HookMode
+	f    func(key []byte, old, new interface{}) error
+}
+
+type deleteHook struct {
+	mode HookMode
+	f    func(key []byte, old interface{}) error
+}
+
+// OnPut register f to be called for every put, old is nil if the key did not exist.
+// It return a function to remove the hook.
+// Hooks are called synchronously by the writer, so slow hooks slow down writers.
+// The key passed to hooks is a copy owned by the hook, so it may be retained after the call.
+func (t *ART) OnPut(mode HookMode, f func(key []byte, old, new interface{}) error) (remove func()) {
+	h := &putHook{mode: mode, f: f}
+	t.updateObservers(func(o *observers) {
+		o.putHooks = append(o.putHooks, h)
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.updateObservers(func(o *observers) {
+				for i, x := range o.putHooks {
+					if x == h {
+						o.putHooks = append(o.putHooks[:i], o.putHooks[i+1:]...)
+						break
+					}
+				}
+			})
+		})
+	}
+}
+
+// OnDelete register f to be called for every deleted key, and return a function to remove the hook.
+// Hooks are called synchronously by the writer, so slow hooks slow down writers.
+// The key passed to hooks is a copy owned by the hook, so it may be retained after the call.
+func (t *ART) OnDelete(mode HookMode, f func(key []byte, old interface{}) error) (remove func()) {
+	h := &deleteHook{mode: mode, f: f}
+	t.updateObservers(func(o *observers) {
+		o.deleteHooks = append(o.deleteHooks, h)
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.updateObservers(func(o *observers) {
+				for i, x := range o.deleteHooks {
+					if x == h {
+						o.deleteHooks = append(o.deleteHooks[:i], o.deleteHooks[i+1:]...)
+						break
+					}
+				}
+			})
+		})
+	}
+}
+
+// guard run before hooks of a change with the changed node locked, and record the error vetoing it.
+// It also treat leaves expired at now as absent, and collect the expired leaves removed by the change.
+// A nil guard allows all changes and never expire a leaf.
+type guard struct {
+	// o is nil if there is no before hook.
+	o     *observers
+	key   []byte
+	value interface{}
+	err   error
+	// copied means key is already copied, the key given by caller may be a reused buffer.
+	copied bool
+
+	now    int64
+	reaped []KV
+	// onlyExpired means the change is removing the key because it's expired.
+	onlyExpired bool
+}
+
+// guard return the guard of changing key to value, or nil if there is no before hook
+// and no key put with TTL.
+func (t *ART) guard(key []byte, value interface{}) *guard {
+	o := t.loadObservers()
+	if o != nil && !o.hasBefore {
+		o = nil
+	}
+	now := t.now()
+	if o == nil && now == 0 {
+		return nil
+	}
+	return &guard{o: o, key: key, value: value, now: now}
+}
+
+// put run before hooks of putting the key, and return false if the put is vetoed.
+func (g *guard) put(old interface{}) bool {
+	if g == nil || g.o == nil {
+		return true
+	}
+	for _, h := range g.o.putHooks {
+		if h.mode != HookBefore {
+			continue
+		}
+		if g.err = h.f(g.hookKey(), old, g.value); g.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// delete run before hooks of deleting the key, and return false if the delete is vetoed.
+func (g *guard) delete(old interface{}) bool {
+	if g == nil || g.o == nil {
+		return true
+	}
+	for _, h := range g.o.deleteHooks {
+		if h.mode != HookBefore {
+			continue
+		}
+		if g.err = h.f(g.hookKey(), old); g.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// hookKey return the key passed to hooks, which is copied once for all hooks of the change.
+func (g *guard) hookKey() []byte {
+	if !g.copied {
+		g.key = append(make([]byte, 0, len(g.key)), g.key...)
+		g.copied = true
+	}
+	return g.key
+}
+
+// putKey is same as put, but for changes of keys not known when g is created.
+func (g *guard) putKey(key []byte, old, new interface{}) bool {
+	if g == nil {
+		return true
+	}
+	g.key, g.value, g.copied = key, new, false
+	return g.put(old)
+}
+
+// deleteKey is same as delete, but for changes of keys not known when g is created.
+func (g *guard) deleteKey(key []byte, old interface{}) bool {
+	if g == nil {
+		return true
+	}
+	g.key, g.copied = key, false
+	return g.delete(old)
+}
+
+// vetoed return the error vetoing the change, or nil if the change is applied.
+func (g *guard) vetoed() error {
+	if g == nil {
+		return nil
+	}
+	return g.err
+}
@@ -0,0 +1,211 @@
+package art
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+
+	// Maintain the total size of values as a derived index.
+	var size int64
+	removePut := art.OnPut(HookAfter, func(key []byte, old, new interface{}) error {
+		if old != nil {
+			atomic.AddInt64(&size, -int64(len(old.(string))))
+		}
+		atomic.AddInt64(&size, int64(len(new.(string))))
+		return nil
+	})
+	removeDelete := art.OnDelete(HookAfter, func(key []byte, old interface{}) error {
+		atomic.AddInt64(&size, -int64(len(old.(string))))
+		return nil
+	})
+
+	art.Put([]byte("a"), "12345")
+	art.Put([]byte("a"), "123")
+	art.PutBatch([][]byte{[]byte("b"), []byte("c")}, []interface{}{"12", "1"})
+	assert.Equal(int64(6), size)
+	art.Delete([]byte("missing"))
+	art.Delete([]byte("c"))
+	assert.Equal(int64(5), size)
+	art.Move([]byte("b"), []byte("bb"))
+	assert.Equal(int64(5), size)
+	art.PopMin()
+	assert.Equal(int64(2), size)
+	art.DeleteIf(nil, nil, func(key []byte, value interface{}) bool {
+		return true
+	})
+	assert.Equal(int64(0), size)
+
+	removePut()
+	removeDelete()
+	removePut()
+	art.Put([]byte("a"), "12345")
+	assert.Equal(int64(0), size)
+	assert.False(art.observed())
+}
+
+func TestBeforeHooks(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a", "ab", "readonly")
+	errReadOnly := errors.New("read only")
+
+	var puts, deletes []string
+	art.OnPut(HookBefore, func(key []byte, old, new interface{}) error {
+		if string(key) == "readonly" {
+			return errReadOnly
+		}
+		puts = append(puts, string(key))
+		return nil
+	})
+	art.OnDelete(HookBefore, func(key []byte, old interface{}) error {
+		if string(key) == "readonly" {
+			return errReadOnly
+		}
+		deletes = append(deletes, string(key))
+		return nil
+	})
+	ch, cancel := art.Watch(nil)
+	defer cancel()
+
+	ctx := context.Background()
+	assert.NoError(art.PutContext(ctx, []byte("abc"), "abc"))
+	assert.Equal(errReadOnly, art.PutContext(ctx, []byte("readonly"), "x"))
+	assert.Equal(errReadOnly, art.DeleteContext(ctx, []byte("readonly")))
+	art.Put([]byte("readonly"), "x")
+	art.Delete([]byte("readonly"))
+	art.DeleteBatch([][]byte{[]byte("readonly"), []byte("a")})
+	assert.NoError(art.DeleteContext(ctx, []byte("ab")))
+
+	v, ok := art.Get([]byte("readonly"))
+	assert.True(ok)
+	assert.Equal("readonly", v)
+	assert.Equal([]string{"abc"}, puts)
+	assert.Equal([]string{"a", "ab"}, deletes)
+
+	// Vetoed changes are not reported.
+	for _, k := range []string{"abc", "a", "ab"} {
+		assert.Equal(k, string((<-ch).Key))
+	}
+	assert.Len(ch, 0)
+}
+
+func TestBeforeHooksBulk(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a", "b", "c", "lock/a", "lock/b", "x/a", "x/b", "z")
+	errLocked := errors.New("locked")
+	locked := func(key []byte) error {
+		if k := string(key); strings.HasPrefix(k, "lock/") || k == "a" || k == "z" {
+			return errLocked
+		}
+		return nil
+	}
+	deletes := make(map[string]int)
+	art.OnPut(HookBefore, func(key []byte, old, new interface{}) error {
+		return locked(key)
+	})
+	art.OnDelete(HookBefore, func(key []byte, old interface{}) error {
+		if err := locked(key); err != nil {
+			return err
+		}
+		deletes[string(key)]++
+		return nil
+	})
+	ch, cancel := art.Watch(nil)
+	defer cancel()
+
+	_, _, ok := art.PopMin()
+	assert.False(ok)
+	_, _, ok = art.PopMax()
+	assert.False(ok)
+	assert.False(art.Move([]byte("b"), []byte("lock/c")))
+	assert.False(art.Move([]byte("lock/a"), []byte("e")))
+	assert.True(art.Move([]byte("b"), []byte("e")))
+	assert.Equal(0, art.MovePrefix([]byte("x/"), []byte("lock/")))
+	assert.Equal(0, art.MovePrefix([]byte("lock/"), []byte("y/")))
+	assert.Equal(2, art.MovePrefix([]byte("x/"), []byte("y/")))
+	assert.Equal(map[string]int{"b": 1, "x/a": 1, "x/b": 1}, deletes)
+	assert.Len(ch, 6)
+
+	assert.Equal(4, art.DeleteIf(nil, nil, func(key []byte, value interface{}) bool {
+		return true
+	}))
+	for _, k := range []string{"c", "e", "y/a", "y/b"} {
+		assert.True(deletes[k] > 0, k)
+	}
+	assert.Equal([][]byte{[]byte("a"), []byte("lock/a"), []byte("lock/b"), []byte("z")}, collectKeys(art))
+	assert.Len(ch, 10)
+}
+
+func TestHooksRetainKey(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	view := art.Sub([]byte("v/"))
+
+	// View.Delete pass a pooled buffer to the tree, hooks must get keys not changed by later deletes.
+	var before, after []string
+	var beforeKeys, afterKeys [][]byte
+	art.OnDelete(HookBefore, func(key []byte, old interface{}) error {
+		before = append(before, string(key))
+		beforeKeys = append(beforeKeys, key)
+		return nil
+	})
+	art.OnDelete(HookAfter, func(key []byte, old interface{}) error {
+		after = append(after, string(key))
+		afterKeys = append(afterKeys, key)
+		return nil
+	})
+	for _, k := range []string{"aaaa", "bbbb", "cccc"} {
+		view.Put([]byte(k), k)
+	}
+	for _, k := range []string{"aaaa", "bbbb", "cccc"} {
+		view.Delete([]byte(k))
+	}
+	assert.Equal([]string{"v/aaaa", "v/bbbb", "v/cccc"}, before)
+	assert.Equal(before, after)
+	for i := range before {
+		assert.Equal(before[i], string(beforeKeys[i]))
+		assert.Equal(after[i], string(afterKeys[i]))
+	}
+}
+
+func TestConcurrentHooks(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	var count int64
+	art.OnPut(HookBefore, func(key []byte, old, new interface{}) error {
+		if old == nil {
+			atomic.AddInt64(&count, 1)
+		}
+		return nil
+	})
+	art.OnDelete(HookAfter, func(key []byte, old interface{}) error {
+		atomic.AddInt64(&count, -1)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(keys); j += 4 {
+				art.Put(keys[j], keys[j])
+				if j%3 == 0 {
+					art.Delete(keys[j])
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(int64(len(collectKeys(art))), count)
+}
@@ -0,0 +1,180 @@
+//go:build go1.23
+
+package art
+
+import (
+	"bytes"
+	"iter"
+	"sync/atomic"
+	"unsafe"
+)
+
+// All return an iterator over all keys and values in this tree in ascending order.
+// The iterator is thread safe, and it's body may modify this tree as OpFunc does.
+func (t *ART) All() iter.Seq2[[]byte, interface{}] {
+	return t.Between(nil, nil)
+}
+
+// Backward return an iterator over all keys and values in this tree in descending order.
+// The iterator is thread safe, and it's body may modify this tree as OpFunc does.
+func (t *ART) Backward() iter.Seq2[[]byte, interface{}] {
+	return func(yield func([]byte, interface{}) bool) {
+		it := &reverseIterator{
+			f: func(key []byte, value interface{}) bool {
+				return !yield(key, value)
+			},
+		}
+		t.iterateReverse(it)
+	}
+}
+
+// Keys return an iterator over all keys in this tree in ascending order.
+func (t *ART) Keys() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for k := range t.All() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values return an iterator over all values in this tree in ascending order of their keys.
+func (t *ART) Values() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		for _, v := range t.All() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Between return an iterator over keys and values in [begin, end) in ascending order.
+// If end is nil, the range has no upper bound.
+// The iterator is thread safe, and it's body may modify this tree as OpFunc does.
+func (t *ART) Between(begin, end []byte) iter.Seq2[[]byte, interface{}] {
+	return func(yield func([]byte, interface{}) bool) {
+		it := &iterator{
+			begin:        begin,
+			end:          end,
+			includeBegin: true,
+			unbounded:    end == nil,
+			f: func(key []byte, value interface{}) bool {
+				return !yield(key, value)
+			},
+		}
+		t.iterate(it)
+	}
+}
+
+// reverseIterator is same as iterator, but visit keys in descending order.
+type reverseIterator struct {
+	// prev record the last applied key, iterate restart from the key before it.
+	prev    []byte
+	started bool
+
+	// path is the key bytes from root to the current node.
+	path []byte
+
+	// now is the time keys are checked for expiration.
+	now int64
+
+	f OpFunc
+}
+
+func (t *ART) iterateReverse(it *reverseIterator) {
+	it.now = t.now()
+	for {
+		it.path = it.path[:0]
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if _, ok := n.reverseIterOpt(it, 0, nil, 0, it.started); ok {
+			return
+		}
+	}
+}
+
+func (it *reverseIterator) apply(key []byte, value interface{}) bool {
+	it.prev, it.started = key, true
+	return it.f(key, value)
+}
+
+// reverseIterOpt visit keys in subtree n in descending order. If onBound is true, n is on the
+// path of it.prev and only keys less than it.prev are visited.
+func (n *node) reverseIterOpt(it *reverseIterator, depth int, parent *node, parentVersion uint64, onBound bool) (end, ok bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return false, false
+	}
+
+	if it.path, ok = n.appendPrefix(it.path, version, depth); !ok {
+		return false, false
+	}
+	depth += n.prefixLen
+
+	// prev is changed once a key is applied, but following keys are always less than it.
+	bound := it.prev
+	if onBound {
+		l := min(depth, len(bound))
+		cmp := bytes.Compare(it.path[:l], bound[:l])
+		if cmp > 0 || (cmp == 0 && len(bound) <= depth) {
+			// All keys in this subtree are not less than prev.
+			return false, n.rUnlock(version)
+		}
+		onBound = cmp == 0
+	}
+
+	from := 255
+	if onBound {
+		from = int(bound[depth])
+	}
+	for from >= 0 {
+		key, child := n.childBefore(from)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if child == nil {
+			break
+		}
+		from = int(key) - 1
+
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, v, dead := l.key, l.value, l.expired(it.now)
+			if !n.lockCheck(version) {
+				return false, false
+			}
+			if dead || (onBound && bytes.Compare(k, bound) >= 0) {
+				continue
+			}
+			if it.apply(k, v) {
+				return true, true
+			}
+			continue
+		}
+
+		it.path = append(it.path[:depth], key)
+		end, ok := child.reverseIterOpt(it, depth+1, n, version, onBound && key == bound[depth])
+		if !ok {
+			return false, false
+		}
+		if end {
+			return true, true
+		}
+	}
+
+	// The prefix leaf is less than all children, and less than prev if n is on it's path.
+	if l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf)); l != nil {
+		k, v, dead := l.key, l.value, l.expired(it.now)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if !dead && it.apply(k, v) {
+			return true, true
+		}
+	}
+	return false, n.lockCheck(version)
+}
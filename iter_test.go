@@ -0,0 +1,101 @@
+//go:build go1.23
+
+package art
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIterators(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	art.Put(nil, nil)
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+	all := append([][]byte{nil}, keys...)
+
+	var result [][]byte
+	for k, v := range art.All() {
+		if k != nil {
+			assert.Equal(k, v)
+		}
+		result = append(result, k)
+	}
+	assert.Equal(all, result)
+	assert.Equal(all, slices.Collect(art.Keys()))
+	assert.Equal(len(all), len(slices.Collect(art.Values())))
+
+	result = result[:0]
+	for k := range art.Backward() {
+		result = append(result, k)
+	}
+	slices.Reverse(result)
+	assert.Equal(all, result)
+
+	b, e := len(keys)/3, len(keys)/3*2
+	result = result[:0]
+	for k := range art.Between(keys[b], keys[e]) {
+		result = append(result, k)
+	}
+	assert.Equal(keys[b:e], result)
+	result = result[:0]
+	for k := range art.Between(keys[e], nil) {
+		result = append(result, k)
+	}
+	assert.Equal(keys[e:], result)
+
+	count := 0
+	for range art.Backward() {
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(10, count)
+}
+
+func TestIteratorsWithWriters(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for i, k := range keys {
+		if i%2 == 0 {
+			art.Put(k, k)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, k := range keys {
+			if i%2 == 1 {
+				art.Put(k, k)
+			}
+		}
+	}()
+
+	var prev []byte
+	count := 0
+	for k := range art.Backward() {
+		if prev != nil {
+			assert.True(string(k) < string(prev))
+		}
+		prev = k
+		count++
+	}
+	wg.Wait()
+	assert.True(count >= (len(keys)+1)/2)
+
+	// Deleting visited keys in the loop body.
+	for k := range art.Backward() {
+		art.Delete(k)
+	}
+	assert.Empty(slices.Collect(art.Keys()))
+}
@@ -0,0 +1,220 @@
+package art
+
+import (
+	"bytes"
+	"sync/atomic"
+	"unsafe"
+)
+
+// List call f with keys having prefix in ascending order until f return true, like listing a
+// directory of object store. If a key has delimiter after prefix, the part of it up to and including
+// the first such delimiter is passed to f once as a common prefix with nil value, and isCommonPrefix
+// is true. Subtrees under a common prefix are skipped without visiting their keys.
+// This operation is thread safe, and f may modify this tree as OpFunc does.
+func (t *ART) List(prefix []byte, delimiter byte, f func(key []byte, value interface{}, isCommonPrefix bool) bool) {
+	it := &listIterator{prefix: prefix, delimiter: delimiter, f: f, now: t.now()}
+	for {
+		it.path = it.path[:0]
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if _, ok := n.listOpt(it, 0, nil, 0); ok {
+			return
+		}
+	}
+}
+
+type listIterator struct {
+	prefix    []byte
+	delimiter byte
+
+	// prev is the last applied key or common prefix, iterate restart from the key after it.
+	// If prevIsCommon is true, keys having prev as prefix are skipped as well.
+	prev         []byte
+	prevIsCommon bool
+
+	// path is the key bytes from root to the current node.
+	path []byte
+	// now is the time keys are checked for expiration, a common prefix is only passed to f
+	// if some keys having it are not expired.
+	now int64
+
+	f func(key []byte, value interface{}, isCommonPrefix bool) bool
+}
+
+// commonPrefix return the common prefix of key, or nil if there is no delimiter after prefix.
+func (it *listIterator) commonPrefix(key []byte) []byte {
+	if i := bytes.IndexByte(key[len(it.prefix):], it.delimiter); i >= 0 {
+		l := len(it.prefix) + i + 1
+		return key[:l:l]
+	}
+	return nil
+}
+
+// after check whether key is not applied yet.
+func (it *listIterator) after(key []byte) bool {
+	if it.prev == nil {
+		return true
+	}
+	if it.prevIsCommon && bytes.HasPrefix(key, it.prev) {
+		return false
+	}
+	return bytes.Compare(key, it.prev) > 0
+}
+
+// apply pass key or common prefix to f if it's not applied yet.
+func (it *listIterator) apply(key []byte, value interface{}, isCommonPrefix bool) bool {
+	if !it.after(key) {
+		return false
+	}
+	if key == nil {
+		key = []byte{}
+	}
+	it.prev, it.prevIsCommon = key, isCommonPrefix
+	return it.f(key, value, isCommonPrefix)
+}
+
+func (it *listIterator) applyKey(key []byte, value interface{}) bool {
+	if cp := it.commonPrefix(key); cp != nil {
+		return it.apply(cp, nil, true)
+	}
+	return it.apply(key, value, false)
+}
+
+func (n *node) listOpt(it *listIterator, depth int, parent *node, parentVersion uint64) (end, ok bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return false, false
+	}
+
+	if it.path, ok = n.appendPrefix(it.path, version, depth); !ok {
+		return false, false
+	}
+	depth += n.prefixLen
+
+	l := min(depth, len(it.prefix))
+	if !bytes.Equal(it.path[:l], it.prefix[:l]) {
+		return false, n.rUnlock(version)
+	}
+	if it.prev != nil {
+		l := min(depth, len(it.prev))
+		cmp := bytes.Compare(it.path[:l], it.prev[:l])
+		if cmp < 0 || (cmp == 0 && depth >= len(it.prev) && it.prevIsCommon) {
+			// All keys in this subtree are already applied.
+			return false, n.rUnlock(version)
+		}
+	}
+
+	if depth < len(it.prefix) {
+		// Only the child on the path of prefix has keys having it.
+		child, _, _ := n.findChild(it.prefix[depth])
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if child == nil {
+			return false, true
+		}
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, v, dead := l.key, l.value, l.expired(it.now)
+			if !n.lockCheck(version) {
+				return false, false
+			}
+			if dead || !bytes.HasPrefix(k, it.prefix) {
+				return false, true
+			}
+			return it.applyKey(k, v), true
+		}
+		it.path = append(it.path[:depth], it.prefix[depth])
+		return child.listOpt(it, depth+1, n, version)
+	}
+
+	if cp := it.commonPrefix(it.path[:depth]); cp != nil {
+		// All keys in this subtree have the same common prefix.
+		cp = append([]byte(nil), cp...)
+		if it.now == 0 {
+			if !n.rUnlock(version) {
+				return false, false
+			}
+			return it.apply(cp, nil, true), true
+		}
+		live, ok := n.liveSizeOpt(version, it.now, 1)
+		if !ok {
+			return false, false
+		}
+		return live > 0 && it.apply(cp, nil, true), true
+	}
+
+	if l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf)); l != nil {
+		k, v, dead := l.key, l.value, l.expired(it.now)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if !dead && it.apply(k, v, false) {
+			return true, true
+		}
+	}
+
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if child == nil {
+			break
+		}
+		next = int(key) + 1
+
+		if key == it.delimiter {
+			// The child is a common prefix ending with this byte.
+			live, ok := childLiveOpt(n, version, child, it.now)
+			if !ok {
+				return false, false
+			}
+			cp := append(append([]byte(nil), it.path[:depth]...), key)
+			if live && it.apply(cp, nil, true) {
+				return true, true
+			}
+			continue
+		}
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, v, dead := l.key, l.value, l.expired(it.now)
+			if !n.lockCheck(version) {
+				return false, false
+			}
+			if !dead && it.applyKey(k, v) {
+				return true, true
+			}
+			continue
+		}
+
+		it.path = append(it.path[:depth], key)
+		end, ok := child.listOpt(it, depth+1, n, version)
+		if !ok {
+			return false, false
+		}
+		if end {
+			return true, true
+		}
+	}
+	return false, n.lockCheck(version)
+}
+
+// childLiveOpt check whether subtree child of n has keys not expired at now.
+func childLiveOpt(n *node, version uint64, child *node, now int64) (live, ok bool) {
+	if now == 0 {
+		return true, true
+	}
+	if child.nodeType == typeLeaf {
+		dead := (*leaf)(unsafe.Pointer(child)).expired(now)
+		return !dead, n.lockCheck(version)
+	}
+	childVersion, ok := child.rLock()
+	if !ok {
+		return false, false
+	}
+	count, ok := child.liveSizeOpt(childVersion, now, 1)
+	return count > 0, ok && n.lockCheck(version)
+}
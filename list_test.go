@@ -0,0 +1,125 @@
+package art
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type listResult struct {
+	key      string
+	value    interface{}
+	isCommon bool
+}
+
+// listByScan is the expected result of List computed by visiting every key.
+func listByScan(keys []string, prefix string, delimiter byte) []listResult {
+	var result []listResult
+	bkeys := make([][]byte, len(keys))
+	for i, k := range keys {
+		bkeys[i] = []byte(k)
+	}
+	for _, k := range sortedKeys(bkeys) {
+		if !bytes.HasPrefix(k, []byte(prefix)) {
+			continue
+		}
+		if i := bytes.IndexByte(k[len(prefix):], delimiter); i >= 0 {
+			cp := string(k[:len(prefix)+i+1])
+			if l := len(result); l == 0 || result[l-1].key != cp {
+				result = append(result, listResult{key: cp, isCommon: true})
+			}
+			continue
+		}
+		result = append(result, listResult{key: string(k), value: string(k)})
+	}
+	return result
+}
+
+func collectList(art *ART, prefix string, delimiter byte) []listResult {
+	var result []listResult
+	art.List([]byte(prefix), delimiter, func(key []byte, value interface{}, isCommonPrefix bool) bool {
+		result = append(result, listResult{key: string(key), value: value, isCommon: isCommonPrefix})
+		return false
+	})
+	return result
+}
+
+func TestList(t *testing.T) {
+	assert := assert.New(t)
+	keys := []string{
+		"",
+		"a",
+		"a/",
+		"a/b",
+		"a/b/c",
+		"a/b/d/e",
+		"a/bb",
+		"a/c/",
+		"a/verylongdirectoryname/x",
+		"a/verylongdirectoryname/y/z",
+		"a/verylongdirectorynamf",
+		"ab",
+		"b/c",
+		"c",
+	}
+	art := newARTWithKeys(keys...)
+	for _, prefix := range []string{"", "a", "a/", "a/b", "a/b/", "a/verylongdirectoryname/", "b/c", "d"} {
+		assert.Equal(listByScan(keys, prefix, '/'), collectList(art, prefix, '/'), "prefix %q", prefix)
+	}
+
+	assert.Equal([]listResult{
+		{key: "", value: ""},
+		{key: "a", value: "a"},
+		{key: "a/", isCommon: true},
+		{key: "ab", value: "ab"},
+		{key: "b/", isCommon: true},
+		{key: "c", value: "c"},
+	}, collectList(art, "", '/'))
+
+	count := 0
+	art.List([]byte("a/"), '/', func(key []byte, value interface{}, isCommonPrefix bool) bool {
+		count++
+		return count == 2
+	})
+	assert.Equal(2, count)
+}
+
+func TestLargeList(t *testing.T) {
+	assert := assert.New(t)
+	var keys []string
+	for _, k := range loadTestData("words.txt", nil) {
+		keys = append(keys, string(k))
+	}
+	art := newARTWithKeys(keys...)
+	for _, prefix := range []string{"", "a", "co", "pre", "zz"} {
+		for _, d := range []byte{'a', 'e', 's'} {
+			assert.Equal(listByScan(keys, prefix, d), collectList(art, prefix, d), "prefix %q delimiter %c", prefix, d)
+		}
+	}
+}
+
+func TestMutateInList(t *testing.T) {
+	assert := assert.New(t)
+	keys := []string{"a/1", "a/2", "b", "c/1", "c/2", "d", "e/1"}
+	art := newARTWithKeys(keys...)
+
+	// Delete keys under every listed common prefix and the key next to it.
+	var result []listResult
+	art.List(nil, '/', func(key []byte, value interface{}, isCommonPrefix bool) bool {
+		result = append(result, listResult{key: string(key), value: value, isCommon: isCommonPrefix})
+		if isCommonPrefix {
+			art.Delete(append(key[:len(key):len(key)], '1'))
+			art.Delete(append(key[:len(key):len(key)], '2'))
+			art.Put([]byte{key[0] + 1}, nil)
+			art.Delete([]byte{key[0] + 1})
+		}
+		return false
+	})
+	assert.Equal([]listResult{
+		{key: "a/", isCommon: true},
+		{key: "c/", isCommon: true},
+		{key: "e/", isCommon: true},
+	}, result)
+	assert.Empty(collectList(art, "", '/'))
+}
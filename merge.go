@@ -0,0 +1,172 @@
+package art
+
+import (
+	"bytes"
+	"container/heap"
+)
+
+// mergeBatchSize is the number of entries fetched from a source at once by MergeIterator.
+const mergeBatchSize = 64
+
+// Scanner is a sorted source of keys and values, which is implemented by ART.
+// ScanInto must behave like ART.ScanInto.
+type Scanner interface {
+	ScanInto(begin, end []byte, keys [][]byte, vals []interface{}) (n int, next []byte)
+}
+
+// Resolver decide the values of a key merged from multiple sources. values are ordered as the sources
+// having the key, and the returned values are yielded in order, a key is dropped if nothing is returned.
+type Resolver func(key []byte, values []interface{}) []interface{}
+
+// NewestWins is a Resolver keep the value from the last source, which is assumed to be the newest.
+func NewestWins(key []byte, values []interface{}) []interface{} {
+	return values[len(values)-1:]
+}
+
+// KeepAll is a Resolver keep values from all sources.
+func KeepAll(key []byte, values []interface{}) []interface{} {
+	return values
+}
+
+// MergeIterator iterate keys in [begin, end) of multiple sources in ascending order, and resolve
+// duplicate keys with a Resolver. Sources are read in batches on demand without extra goroutines,
+// so an iterator can be dropped at any time.
+// Each source is thread safe as ART.ScanInto, but the merged result is not a snapshot.
+// A MergeIterator itself is not thread safe.
+type MergeIterator struct {
+	resolve Resolver
+	cursors mergeHeap
+
+	key    []byte
+	values []interface{}
+	pos    int
+
+	// dup is the values of the current key before resolving.
+	dup []interface{}
+}
+
+// NewMergeIterator create a MergeIterator over keys in [begin, end) of sources. If end is nil,
+// the range has no upper bound. Sources should be ordered from the oldest to the newest,
+// such as generations of a tree. If resolve is nil, NewestWins is used.
+func NewMergeIterator(begin, end []byte, resolve Resolver, sources ...Scanner) *MergeIterator {
+	if resolve == nil {
+		resolve = NewestWins
+	}
+	it := &MergeIterator{resolve: resolve}
+	for i, src := range sources {
+		c := &mergeCursor{
+			src:  src,
+			idx:  i,
+			next: begin,
+			end:  end,
+			keys: make([][]byte, mergeBatchSize),
+			vals: make([]interface{}, mergeBatchSize),
+		}
+		if c.fill() {
+			it.cursors = append(it.cursors, c)
+		}
+	}
+	heap.Init(&it.cursors)
+	return it
+}
+
+// Next move to the next key and value, and return false if there is nothing left.
+func (it *MergeIterator) Next() bool {
+	it.pos++
+	for it.pos >= len(it.values) {
+		if len(it.cursors) == 0 {
+			it.key, it.values = nil, nil
+			return false
+		}
+		it.merge()
+	}
+	return true
+}
+
+// Key return the current key, it must not be modified.
+func (it *MergeIterator) Key() []byte {
+	return it.key
+}
+
+// Value return the current value.
+func (it *MergeIterator) Value() interface{} {
+	return it.values[it.pos]
+}
+
+// merge pop the minimal key from all sources, and resolve it's values.
+func (it *MergeIterator) merge() {
+	it.dup = it.dup[:0]
+	key := it.cursors[0].key()
+	for len(it.cursors) > 0 && bytes.Equal(it.cursors[0].key(), key) {
+		// Cursors having the same key are popped in order of sources.
+		c := it.cursors[0]
+		it.dup = append(it.dup, c.vals[c.pos])
+		if c.advance() {
+			heap.Fix(&it.cursors, 0)
+		} else {
+			heap.Pop(&it.cursors)
+		}
+	}
+	it.key, it.values, it.pos = key, it.resolve(key, it.dup), 0
+}
+
+type mergeCursor struct {
+	src Scanner
+	idx int
+
+	keys [][]byte
+	vals []interface{}
+	n    int
+	pos  int
+
+	// next is the begin of the following batch, or nil if the source is exhausted.
+	next []byte
+	end  []byte
+}
+
+func (c *mergeCursor) key() []byte {
+	return c.keys[c.pos]
+}
+
+// fill fetch the next batch, and return false if there is nothing left.
+func (c *mergeCursor) fill() bool {
+	if c.next == nil && c.n > 0 {
+		return false
+	}
+	c.n, c.next = c.src.ScanInto(c.next, c.end, c.keys, c.vals)
+	c.pos = 0
+	return c.n > 0
+}
+
+// advance move to the next entry, and return false if there is nothing left.
+func (c *mergeCursor) advance() bool {
+	c.pos++
+	if c.pos < c.n {
+		return true
+	}
+	return c.fill()
+}
+
+type mergeHeap []*mergeCursor
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if cmp := bytes.Compare(h[i].key(), h[j].key()); cmp != 0 {
+		return cmp < 0
+	}
+	return h[i].idx < h[j].idx
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x interface{}) {
+	*h = append(*h, x.(*mergeCursor))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
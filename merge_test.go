@@ -0,0 +1,107 @@
+package art
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeIterator(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	shards := []*ART{NewART(), NewART(), NewART()}
+	expected := make(map[string][]interface{})
+	for i, k := range keys {
+		for j, s := range shards {
+			if (i+j)%(j+2) == 0 {
+				s.Put(k, j)
+				expected[string(k)] = append(expected[string(k)], j)
+			}
+		}
+	}
+	shards[0].Put(nil, 0)
+	expected[""] = []interface{}{0}
+	var all []string
+	for k := range expected {
+		all = append(all, k)
+	}
+	sort.Strings(all)
+
+	var result []string
+	it := NewMergeIterator(nil, nil, nil, shards[0], shards[1], shards[2])
+	for it.Next() {
+		k := string(it.Key())
+		vs := expected[k]
+		assert.Equal(vs[len(vs)-1], it.Value(), "key %s", k)
+		result = append(result, k)
+	}
+	assert.Equal(all, result)
+	assert.False(it.Next())
+
+	result = result[:0]
+	var values []interface{}
+	b, e := keys[len(keys)/3], keys[len(keys)/3*2]
+	it = NewMergeIterator(b, e, KeepAll, shards[0], shards[1], shards[2])
+	for it.Next() {
+		if l := len(result); l == 0 || result[l-1] != string(it.Key()) {
+			result = append(result, string(it.Key()))
+		}
+		values = append(values, it.Value())
+	}
+	var expectedValues []interface{}
+	for _, k := range keys[len(keys)/3 : len(keys)/3*2] {
+		expectedValues = append(expectedValues, expected[string(k)]...)
+	}
+	assert.Equal(expectedValues, values)
+	assert.True(sort.StringsAreSorted(result))
+
+	// Drop keys existing in all shards, and stop early.
+	count := 0
+	it = NewMergeIterator(nil, nil, func(key []byte, values []interface{}) []interface{} {
+		if len(values) == len(shards) {
+			return nil
+		}
+		return values[:1]
+	}, shards[0], shards[1], shards[2])
+	for it.Next() && count < 100 {
+		assert.NotEqual(len(shards), len(expected[string(it.Key())]))
+		count++
+	}
+	assert.Equal(100, count)
+
+	assert.False(NewMergeIterator(nil, nil, nil).Next())
+	assert.False(NewMergeIterator(nil, nil, nil, NewART()).Next())
+}
+
+func TestMergeIteratorConcurrentPut(t *testing.T) {
+	assert := assert.New(t)
+	a, b := NewART(), NewART()
+	for i := 0; i < 1000; i++ {
+		a.Put([]byte(fmt.Sprintf("%04d", i*2)), i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			b.Put([]byte(fmt.Sprintf("%04d", i*2+1)), i)
+		}
+	}()
+
+	var prev []byte
+	count := 0
+	it := NewMergeIterator(nil, nil, nil, a, b)
+	for it.Next() {
+		if prev != nil {
+			assert.True(string(prev) < string(it.Key()))
+		}
+		prev = it.Key()
+		if it.Key()[3]%2 == 0 {
+			count++
+		}
+	}
+	<-done
+	assert.Equal(1000, count)
+}
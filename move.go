@@ -0,0 +1,482 @@
+package art
+
+import (
+	"bytes"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Move rename oldKey to newKey atomically, and return false if oldKey does not exist or the
+// rename is vetoed by a HookBefore hook, which see a put of newKey and a delete of oldKey.
+// If newKey already exists, it's value is replaced by the value of oldKey.
+// The expiration time set by PutWithTTL is moved along with the value.
+// All nodes changed by the rename are locked before any of them is modified, so readers never
+// observe the entry missing from both keys or present in both of them.
+// This operation is thread safe.
+func (t *ART) Move(oldKey, newKey []byte) bool {
+	if bytes.Equal(oldKey, newKey) {
+		_, ex := t.Get(oldKey)
+		return ex
+	}
+	for {
+		m := &mover{t: t}
+		if !m.lockOpt(oldKey, newKey, false) {
+			continue
+		}
+		l := m.get(oldKey)
+		if l == nil || l.expired(t.now()) {
+			m.unlock()
+			return false
+		}
+		value := l.value
+		if !m.before([][]byte{oldKey}, [][]byte{newKey}, []interface{}{value}, t.now()) {
+			m.unlock()
+			return false
+		}
+		old, replaced := m.insert(newKey, l.entry())
+		m.remove(oldKey)
+		m.unlock()
+		t.notify(EventPut, newKey, old, value, replaced)
+		t.notify(EventDelete, oldKey, value, nil, true)
+		return true
+	}
+}
+
+// MovePrefix replace oldPrefix of all keys having it with newPrefix atomically, and return the
+// number of moved keys. Keys already having newPrefix are kept, unless they are replaced by moved keys.
+// If HookBefore hooks veto the put or delete of any key, no key is moved.
+// Like Move, readers observe either all keys before the rename or all keys after it. Nodes under
+// both prefixes are locked during the rename, so operations on these keys will wait for it.
+// This operation is thread safe.
+func (t *ART) MovePrefix(oldPrefix, newPrefix []byte) int {
+	for {
+		m := &mover{t: t}
+		if !m.lockOpt(oldPrefix, newPrefix, true) {
+			continue
+		}
+
+		var (
+			keys    [][]byte
+			values  []interface{}
+			entries []interface{}
+			now     = t.now()
+		)
+		m.prefix(oldPrefix, func(l *leaf) {
+			if !l.expired(now) {
+				keys = append(keys, l.key)
+				values = append(values, l.value)
+				entries = append(entries, l.entry())
+			}
+		})
+		newKeys := make([][]byte, len(keys))
+		for i, k := range keys {
+			newKey := make([]byte, 0, len(newPrefix)+len(k)-len(oldPrefix))
+			newKeys[i] = append(append(newKey, newPrefix...), k[len(oldPrefix):]...)
+		}
+		if !m.before(keys, newKeys, values, now) {
+			m.unlock()
+			return 0
+		}
+
+		moved := make(map[string]struct{}, len(keys))
+		events := make([]Event, 0, 2*len(keys))
+		for i, newKey := range newKeys {
+			old, replaced := m.insert(newKey, entries[i])
+			moved[string(newKey)] = struct{}{}
+			events = append(events, Event{Kind: EventPut, Key: newKey, Old: old, New: values[i], Existed: replaced})
+		}
+		// Remove after all inserts, so the inserts only visit nodes locked by m or created by m.
+		for i, k := range keys {
+			if _, ok := moved[string(k)]; !ok {
+				m.remove(k)
+				events = append(events, Event{Kind: EventDelete, Key: k, Old: values[i], Existed: true})
+			}
+		}
+		m.unlock()
+		for _, e := range events {
+			t.notify(e.Kind, e.Key, e.Old, e.New, e.Existed)
+		}
+		return len(keys)
+	}
+}
+
+// mover lock all inner nodes on the paths of two keys, and change the tree under these nodes
+// without further locking. The paths are started at the deepest node shared by both keys.
+type mover struct {
+	t *ART
+
+	locked   []*node
+	versions map[*node]uint64
+	obsolete map[*node]struct{}
+
+	// start is the location of the deepest inner node on both paths, parent is it's parent.
+	start  *unsafe.Pointer
+	parent *node
+	depth  int
+}
+
+// lockOpt lock nodes on the paths of a and b. If subtree is true, all nodes under a and b are locked
+// as well, which make changes of keys having a or b as prefix safe.
+func (m *mover) lockOpt(a, b []byte, subtree bool) bool {
+	var (
+		pa, pb pathCache
+		sub    []pathEntry
+	)
+	root := (*node)(atomic.LoadPointer(&m.t.root))
+	if !m.collectOpt(root, a, subtree, &pa, &sub) || !m.collectOpt(root, b, subtree, &pb, &sub) {
+		return false
+	}
+
+	c := 1
+	for c < len(pa.entries) && c < len(pb.entries) && pa.entries[c].n == pb.entries[c].n {
+		c++
+	}
+	from := c - 1
+	start := pa.entries[from]
+	m.start, m.depth = start.nodeLoc, start.depth
+	if from > 0 {
+		// The start node may be replaced, so it's parent is locked too.
+		from--
+		m.parent = pa.entries[from].n
+	}
+
+	m.versions = make(map[*node]uint64)
+	m.obsolete = make(map[*node]struct{})
+	for _, entries := range [][]pathEntry{pa.entries[from:], pb.entries[c:], sub} {
+		for _, e := range entries {
+			if v, ok := m.versions[e.n]; ok {
+				if v != e.version {
+					m.unlock()
+					return false
+				}
+				continue
+			}
+			if !e.n.upgradeToLock(e.version) {
+				m.unlock()
+				return false
+			}
+			m.versions[e.n] = e.version
+			m.locked = append(m.locked, e.n)
+		}
+	}
+	return true
+}
+
+// before run before hooks of moving keys to newKeys, and return false if any of them is vetoed.
+// The old values of newKeys are the values before the rename, and keys replaced by other moved keys
+// are not deleted.
+func (m *mover) before(keys, newKeys [][]byte, values []interface{}, now int64) bool {
+	g := m.t.guard(nil, nil)
+	if g == nil || g.o == nil {
+		return true
+	}
+	moved := make(map[string]struct{}, len(newKeys))
+	for i, newKey := range newKeys {
+		var old interface{}
+		if l := m.get(newKey); l != nil && !l.expired(now) {
+			old = l.value
+		}
+		if !g.putKey(newKey, old, values[i]) {
+			return false
+		}
+		moved[string(newKey)] = struct{}{}
+	}
+	for i, k := range keys {
+		if _, ok := moved[string(k)]; !ok && !g.deleteKey(k, values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// collectOpt record inner nodes on the path of key, and nodes under key if subtree is true.
+func (m *mover) collectOpt(n *node, key []byte, subtree bool, path *pathCache, sub *[]pathEntry) bool {
+	var (
+		depth   int
+		nodeLoc = &m.t.root
+	)
+	for {
+		version, ok := n.rLock()
+		if !ok {
+			return false
+		}
+		path.push(n, version, depth, nodeLoc)
+
+		p, l := n.checkPrefix(key, depth), min(len(key)-depth, min(n.prefixLen, maxPrefixLen))
+		if p < l {
+			return n.lockCheck(version)
+		}
+		if depth+n.prefixLen >= len(key) {
+			if subtree {
+				return collectSubtreeOpt(n, version, sub)
+			}
+			return n.lockCheck(version)
+		}
+		depth += n.prefixLen
+
+		child, loc, _ := n.findChild(key[depth])
+		if !n.lockCheck(version) {
+			return false
+		}
+		if child == nil || child.nodeType == typeLeaf {
+			return true
+		}
+		depth++
+		nodeLoc = loc
+		n = child
+	}
+}
+
+func collectSubtreeOpt(n *node, version uint64, sub *[]pathEntry) bool {
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return false
+		}
+		if child == nil {
+			break
+		}
+		next = int(key) + 1
+		if child.nodeType == typeLeaf {
+			continue
+		}
+
+		v, ok := child.rLock()
+		if !ok {
+			return false
+		}
+		*sub = append(*sub, pathEntry{n: child, version: v})
+		if !collectSubtreeOpt(child, v, sub) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *mover) unlock() {
+	for _, n := range m.locked {
+		if _, ok := m.obsolete[n]; ok {
+			n.unlockObsolete()
+		} else {
+			n.unlock()
+		}
+	}
+}
+
+// get return the leaf of key, or nil if key does not exist.
+func (m *mover) get(key []byte) *leaf {
+	n, depth := (*node)(atomic.LoadPointer(m.start)), m.depth
+	for {
+		if n.checkPrefix(key, depth) != min(n.prefixLen, maxPrefixLen) {
+			return nil
+		}
+		depth += n.prefixLen
+
+		if depth == len(key) {
+			if l := (*leaf)(n.prefixLeaf); l != nil && l.match(key) {
+				return l
+			}
+			return nil
+		}
+		if depth > len(key) {
+			return nil
+		}
+
+		child, _, _ := n.findChild(key[depth])
+		if child == nil {
+			return nil
+		}
+		if child.nodeType == typeLeaf {
+			if l := (*leaf)(unsafe.Pointer(child)); l.match(key) {
+				return l
+			}
+			return nil
+		}
+		depth++
+		n = child
+	}
+}
+
+// prefix call f with leaves of all keys having the given prefix, they are all under locked nodes.
+func (m *mover) prefix(prefix []byte, f func(l *leaf)) {
+	var walk func(n unsafe.Pointer)
+	walk = func(n unsafe.Pointer) {
+		if (*node)(n).nodeType == typeLeaf {
+			f((*leaf)(n))
+			return
+		}
+		if l := (*node)(n).prefixLeaf; l != nil {
+			f((*leaf)(l))
+		}
+		(*node)(n).eachChild(func(_ byte, child unsafe.Pointer) {
+			walk(child)
+		})
+	}
+
+	n, depth := (*node)(atomic.LoadPointer(m.start)), m.depth
+	for {
+		if key := n.lockedKey(); depth+n.prefixLen >= len(prefix) {
+			if bytes.HasPrefix(key, prefix) {
+				walk(unsafe.Pointer(n))
+			}
+			return
+		} else if !bytes.Equal(key[depth:depth+n.prefixLen], prefix[depth:depth+n.prefixLen]) {
+			return
+		}
+		depth += n.prefixLen
+
+		child, _, _ := n.findChild(prefix[depth])
+		if child == nil {
+			return
+		}
+		if child.nodeType == typeLeaf {
+			if l := (*leaf)(unsafe.Pointer(child)); bytes.HasPrefix(l.key, prefix) {
+				f(l)
+			}
+			return
+		}
+		depth++
+		n = child
+	}
+}
+
+// insert is same as insertOpt, but all changed nodes are already locked by m.
+func (m *mover) insert(key []byte, value interface{}) (old interface{}, replaced bool) {
+	n, depth, nodeLoc := (*node)(atomic.LoadPointer(m.start)), m.depth, m.start
+	for {
+		var fullKey []byte
+		p := n.checkPrefix(key, depth)
+		if n.prefixLen > maxPrefixLen {
+			fullKey = n.lockedKey()
+			p = commonPrefixLen(key[depth:], fullKey[depth:depth+n.prefixLen])
+		}
+		if p != n.prefixLen {
+			n.insertSplitPrefix(key, fullKey, value, depth, p, nodeLoc)
+			return nil, false
+		}
+		depth += n.prefixLen
+
+		if depth == len(key) {
+			return n.updatePrefixLeaf(key, value)
+		}
+
+		next, nextLoc, _ := n.findChild(key[depth])
+		if next == nil {
+			if n.isFull() {
+				m.publish(nodeLoc, func(loc *unsafe.Pointer) {
+					n.growAndInsert(key[depth], unsafe.Pointer(newLeaf(key, value)), loc)
+				})
+				m.obsolete[n] = struct{}{}
+			} else {
+				n.insertChild(key[depth], unsafe.Pointer(newLeaf(key, value)))
+			}
+			return nil, false
+		}
+		if next.nodeType == typeLeaf {
+			return (*leaf)(unsafe.Pointer(next)).updateOrExpand(key, value, depth+1, nextLoc)
+		}
+		depth++
+		nodeLoc = nextLoc
+		n = next
+	}
+}
+
+// remove is same as removeOpt, but all changed nodes are already locked by m.
+func (m *mover) remove(key []byte) {
+	n, parent, depth, nodeLoc := (*node)(atomic.LoadPointer(m.start)), m.parent, m.depth, m.start
+	for {
+		if n.checkPrefix(key, depth) != min(n.prefixLen, maxPrefixLen) {
+			return
+		}
+		depth += n.prefixLen
+
+		if depth == len(key) {
+			if l := (*leaf)(n.prefixLeaf); l == nil || !l.match(key) {
+				return
+			}
+			atomic.StorePointer(&n.prefixLeaf, nil)
+			if n.shouldCompress(parent) {
+				m.compress((*node4)(unsafe.Pointer(n)), 0, nodeLoc)
+				m.obsolete[n] = struct{}{}
+			}
+			return
+		}
+		if depth > len(key) {
+			return
+		}
+
+		next, nextLoc, idx := n.findChild(key[depth])
+		if next == nil {
+			return
+		}
+		if next.nodeType == typeLeaf {
+			if !(*leaf)(unsafe.Pointer(next)).match(key) {
+				return
+			}
+			if !n.shouldShrink(parent) {
+				n.removeChild(idx)
+				return
+			}
+			if n.nodeType != typeNode4 {
+				m.publish(nodeLoc, func(loc *unsafe.Pointer) {
+					n.removeChildAndShrink(key[depth], loc)
+				})
+			} else if n4 := (*node4)(unsafe.Pointer(n)); n4.prefixLeaf != nil {
+				atomic.StorePointer(nodeLoc, n4.prefixLeaf)
+			} else {
+				m.compress(n4, 1-idx, nodeLoc)
+			}
+			m.obsolete[n] = struct{}{}
+			return
+		}
+		depth++
+		parent = n
+		nodeLoc = nextLoc
+		n = next
+	}
+}
+
+// publish store the node created by build to nodeLoc. The node is locked by m before published,
+// because m may still change it, and readers of the root have no parent version to detect the change.
+func (m *mover) publish(nodeLoc *unsafe.Pointer, build func(loc *unsafe.Pointer)) {
+	var p unsafe.Pointer
+	build(&p)
+	if n := (*node)(p); n.nodeType != typeLeaf {
+		// The node is not reachable yet, so it's always locked at version 0.
+		n.lock()
+		m.versions[n] = 0
+		m.locked = append(m.locked, n)
+	}
+	atomic.StorePointer(nodeLoc, p)
+}
+
+// compress is same as compressChild, but don't lock the child if it's already locked by m.
+func (m *mover) compress(n *node4, idx int, nodeLoc *unsafe.Pointer) {
+	child := (*node)(n.children[idx])
+	if _, ok := m.versions[child]; !ok {
+		// The parent is locked, so the child cannot be obsolete.
+		n.compressChild(idx, nodeLoc)
+		return
+	}
+	n.mergePrefix(n.keys[idx], child)
+	atomic.StorePointer(nodeLoc, unsafe.Pointer(child))
+}
+
+// lockedKey return key of a leaf under n. n must be locked, so keys under it always have the same prefix.
+func (n *node) lockedKey() []byte {
+	for c := n; ; {
+		if l := atomic.LoadPointer(&c.prefixLeaf); l != nil {
+			return (*leaf)(l).key
+		}
+		next := c.firstChild()
+		if next == nil {
+			// Descendants of n may be modified concurrently, try again.
+			c = n
+			continue
+		}
+		if next.nodeType == typeLeaf {
+			return (*leaf)(unsafe.Pointer(next)).key
+		}
+		c = next
+	}
+}
@@ -0,0 +1,190 @@
+package art
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMove(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a", "ab", "abc", "abcdefghijklmn", "b")
+
+	assert.True(art.Move([]byte("ab"), []byte("abcdefghijklmno")))
+	_, ok := art.Get([]byte("ab"))
+	assert.False(ok)
+	v, ok := art.Get([]byte("abcdefghijklmno"))
+	assert.True(ok)
+	assert.Equal("ab", v)
+
+	assert.False(art.Move([]byte("ab"), []byte("c")))
+	_, ok = art.Get([]byte("c"))
+	assert.False(ok)
+
+	// The target is replaced if it exists.
+	assert.True(art.Move([]byte("a"), []byte("b")))
+	v, _ = art.Get([]byte("b"))
+	assert.Equal("a", v)
+	assert.True(art.Move([]byte("b"), []byte("")))
+	assert.True(art.Move([]byte(""), []byte("b")))
+
+	var keys []string
+	for _, k := range collectKeys(art) {
+		keys = append(keys, string(k))
+	}
+	assert.Equal([]string{"abc", "abcdefghijklmn", "abcdefghijklmno", "b"}, keys)
+}
+
+func TestMovePrefix(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	var moved [][]byte
+	for _, k := range keys {
+		if bytes.HasPrefix(k, []byte("ab")) {
+			moved = append(moved, k)
+		}
+	}
+	assert.Equal(len(moved), art.MovePrefix([]byte("ab"), []byte("zz/")))
+	for _, k := range moved {
+		_, ok := art.Get(k)
+		assert.False(ok)
+		v, ok := art.Get(append([]byte("zz/"), k[2:]...))
+		assert.True(ok)
+		assert.Equal(k, v)
+	}
+	assert.Equal(len(keys), len(collectKeys(art)))
+
+	// Move into it's own subtree.
+	assert.Equal(len(moved), art.MovePrefix([]byte("zz/"), []byte("zz/zz/")))
+	count := 0
+	art.Prefix([]byte("zz/"), func(key []byte, value interface{}) bool {
+		assert.True(bytes.HasPrefix(key, []byte("zz/zz/")))
+		count++
+		return false
+	})
+	assert.Equal(len(moved), count)
+	assert.Equal(0, art.MovePrefix([]byte("zz/zz/zz"), []byte("zz/")))
+}
+
+func TestConcurrentMove(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	const (
+		workers = 8
+		steps   = 1000
+	)
+	key := func(w, i int) []byte {
+		return []byte(fmt.Sprintf("%d/%d/%d", i%7, w, i))
+	}
+	for w := 0; w < workers; w++ {
+		art.Put(key(w, 0), w)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < steps; i++ {
+				assert.True(art.Move(key(w, i), key(w, i+1)))
+				art.Put([]byte(fmt.Sprintf("%d/%d/x%d", i%7, w, i)), nil)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < workers; w++ {
+		v, ok := art.Get(key(w, steps))
+		assert.True(ok)
+		assert.Equal(w, v)
+	}
+	assert.Equal(workers*(steps+1), len(collectKeys(art)))
+}
+
+func TestMoveLockGrownRoot(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a", "b", "c", "d")
+	m := &mover{t: art}
+	assert.True(m.lockOpt([]byte("a"), []byte("e"), false))
+
+	// The root is a full node4, so inserting "e" replace it by a node16, which must stay locked
+	// until the mover is done, because readers of the root have no parent version to validate.
+	m.insert([]byte("e"), "a")
+	root := (*node)(atomic.LoadPointer(&art.root))
+	assert.EqualValues(typeNode16, root.nodeType)
+	assert.NotZero(atomic.LoadUint64(&root.version) & 2)
+	assert.Contains(m.locked, root)
+
+	m.remove([]byte("a"))
+	root = (*node)(atomic.LoadPointer(&art.root))
+	assert.NotZero(atomic.LoadUint64(&root.version) & 2)
+	assert.Contains(m.locked, root)
+
+	m.unlock()
+	assert.Zero(atomic.LoadUint64(&root.version) & 2)
+	assert.Equal([][]byte{[]byte("b"), []byte("c"), []byte("d"), []byte("e")}, collectKeys(art))
+}
+
+func TestConcurrentMovePrefixGrowRoot(t *testing.T) {
+	assert := assert.New(t)
+	const n = 1000
+	key := func(prefix string, i int) []byte {
+		return []byte(fmt.Sprintf("%s/%04d", prefix, i))
+	}
+	art := newARTWithKeys("b", "c", "d")
+	for i := 0; i < n; i++ {
+		art.Put(key("a", i), i)
+	}
+	// Readers must run in parallel with the move, even on a single CPU.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	// The root is a full node4, so moving "a" to "e" grow it before moving other keys. phase is odd
+	// while the move is running, a reader must not see the first moved key without the last one.
+	var (
+		wg         sync.WaitGroup
+		phase      int32
+		violations int32
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				p := atomic.LoadInt32(&phase)
+				if p < 0 {
+					return
+				}
+				_, first := art.Get(key("e", 0))
+				_, last := art.Get(key("e", n-1))
+				for _, k := range []string{"b", "c", "d"} {
+					if _, ok := art.Get([]byte(k)); !ok {
+						atomic.AddInt32(&violations, 1)
+					}
+				}
+				if first && !last && p%2 == 1 && atomic.LoadInt32(&phase) == p {
+					atomic.AddInt32(&violations, 1)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		atomic.AddInt32(&phase, 1)
+		assert.Equal(n, art.MovePrefix([]byte("a"), []byte("e")))
+		atomic.AddInt32(&phase, 1)
+		assert.Equal(n, art.MovePrefix([]byte("e"), []byte("a")))
+	}
+	atomic.StoreInt32(&phase, -1)
+	wg.Wait()
+	assert.Zero(atomic.LoadInt32(&violations))
+	assert.Len(collectKeys(art), n+3)
+}
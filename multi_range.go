@@ -0,0 +1,213 @@
+package art
+
+import (
+	"bytes"
+	"sync/atomic"
+	"unsafe"
+)
+
+// KeyRange is an interval of keys.
+type KeyRange struct {
+	Begin        []byte
+	End          []byte
+	IncludeBegin bool
+	IncludeEnd   bool
+}
+
+// MultiRange iterate the keys in several ranges by a single traversal.
+// The ranges must be sorted and disjoint with each other. Subtrees between two ranges are
+// skipped instead of restarting at root for each range.
+// This operation is thread safe.
+func (t *ART) MultiRange(ranges []KeyRange, f OpFunc) {
+	if len(ranges) == 0 {
+		return
+	}
+	it := &multiIterator{
+		ranges: ranges,
+		f:      f,
+		now:    t.now(),
+	}
+	for {
+		it.path = it.path[:0]
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if _, ok := n.multiIterOpt(it, 0, nil, 0); ok {
+			return
+		}
+	}
+}
+
+type multiIterator struct {
+	ranges []KeyRange
+	// idx is the range currently iterated.
+	idx int
+
+	// prev record the last applied key.
+	// When iterate restart due to conflict use prev as new begin key.
+	prev []byte
+
+	// path is the key bytes from root to the current node.
+	path []byte
+	// now is the time keys are checked for expiration.
+	now int64
+
+	f OpFunc
+}
+
+// lower return the current lower bound.
+func (it *multiIterator) lower() ([]byte, bool) {
+	r := &it.ranges[it.idx]
+	if it.prev != nil && bytes.Compare(it.prev, r.Begin) >= 0 {
+		return it.prev, false
+	}
+	return r.Begin, r.IncludeBegin
+}
+
+// seekSubtree locate the subtree whose keys all have it.path as prefix.
+// It skip the ranges end before this subtree, and report whether this subtree is
+// before the current range, or there is no range left.
+func (it *multiIterator) seekSubtree() (skip, end bool) {
+	for ; it.idx < len(it.ranges); it.idx++ {
+		e := it.ranges[it.idx].End
+		l := min(len(it.path), len(e))
+		cmp := bytes.Compare(it.path[:l], e[:l])
+		if cmp < 0 || (cmp == 0 && len(e) >= len(it.path)) {
+			break
+		}
+	}
+	if it.idx == len(it.ranges) {
+		return false, true
+	}
+
+	b, _ := it.lower()
+	l := min(len(it.path), len(b))
+	return bytes.Compare(it.path[:l], b[:l]) < 0, false
+}
+
+// seekKey is same as seekSubtree, but for a single key.
+func (it *multiIterator) seekKey(key []byte) (skip, end bool) {
+	for ; it.idx < len(it.ranges); it.idx++ {
+		r := &it.ranges[it.idx]
+		cmp := bytes.Compare(key, r.End)
+		if cmp < 0 || (cmp == 0 && r.IncludeEnd) {
+			break
+		}
+	}
+	if it.idx == len(it.ranges) {
+		return false, true
+	}
+
+	b, include := it.lower()
+	cmp := bytes.Compare(key, b)
+	return cmp < 0 || (cmp == 0 && !include), false
+}
+
+// startKey return the first child key in the node at depth which may be in the current range.
+func (it *multiIterator) startKey(depth int) int {
+	b, _ := it.lower()
+	if len(b) > depth && bytes.Equal(it.path[:depth], b[:depth]) {
+		return int(b[depth])
+	}
+	return 0
+}
+
+func (it *multiIterator) apply(key []byte, value interface{}) (end bool) {
+	skip, end := it.seekKey(key)
+	if end {
+		return true
+	}
+	if skip {
+		return false
+	}
+	it.prev = key
+	if it.prev == nil {
+		// nil prev means nothing is applied yet.
+		it.prev = []byte{}
+	}
+	return it.f(key, value)
+}
+
+func (n *node) multiIterOpt(it *multiIterator, depth int, parent *node, parentVersion uint64) (end, ok bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return false, false
+	}
+
+	if n.prefixLen > maxPrefixLen {
+		fullKey, ok := n.fullKey(version)
+		if !ok {
+			return false, false
+		}
+		it.path = append(it.path, fullKey[depth:depth+n.prefixLen]...)
+	} else {
+		it.path = append(it.path, n.prefix[:n.prefixLen]...)
+	}
+	if !n.lockCheck(version) {
+		return false, false
+	}
+	depth += n.prefixLen
+
+	skip, end := it.seekSubtree()
+	if end {
+		return true, true
+	}
+	if skip {
+		return false, true
+	}
+
+	prefixLeaf := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
+	if !n.lockCheck(version) {
+		return false, false
+	}
+	if prefixLeaf != nil {
+		k, v, dead := prefixLeaf.key, prefixLeaf.value, prefixLeaf.expired(it.now)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if !dead && it.apply(k, v) {
+			return true, true
+		}
+	}
+
+	for next := 0; next < 256; {
+		key, child := n.childFrom(max(next, it.startKey(depth)))
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if child == nil {
+			break
+		}
+
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, v, dead := l.key, l.value, l.expired(it.now)
+			if !n.lockCheck(version) {
+				return false, false
+			}
+			if !dead && it.apply(k, v) {
+				return true, true
+			}
+		} else {
+			it.path = append(it.path[:depth], key)
+			end, ok := child.multiIterOpt(it, depth+1, n, version)
+			if !ok {
+				return false, false
+			}
+			if end {
+				return true, true
+			}
+		}
+		it.path = it.path[:depth]
+		next = int(key) + 1
+
+		// The current range may be changed by previous child, seek again.
+		if skip, end := it.seekSubtree(); end {
+			return true, true
+		} else if skip {
+			return false, true
+		}
+	}
+	return false, true
+}
@@ -0,0 +1,87 @@
+package art
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleMultiRange(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("1", "12", "123", "1234", "2", "23", "234", "3", "34", "4")
+
+	var result []string
+	art.MultiRange([]KeyRange{
+		{Begin: []byte("12"), End: []byte("1234"), IncludeBegin: false, IncludeEnd: true},
+		{Begin: []byte("2"), End: []byte("2"), IncludeBegin: true, IncludeEnd: true},
+		{Begin: []byte("24"), End: []byte("34"), IncludeBegin: true, IncludeEnd: false},
+		{Begin: []byte("35"), End: []byte("9"), IncludeBegin: true, IncludeEnd: false},
+	}, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return false
+	})
+	assert.Equal([]string{"123", "1234", "2", "3", "4"}, result)
+
+	result = result[:0]
+	art.MultiRange([]KeyRange{
+		{Begin: []byte("1"), End: []byte("2"), IncludeBegin: true},
+		{Begin: []byte("3"), End: []byte("4"), IncludeBegin: true},
+	}, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return len(result) == 5
+	})
+	assert.Equal([]string{"1", "12", "123", "1234", "3"}, result)
+}
+
+func TestMutateInMultiRange(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("", "1", "12", "123", "2", "23", "3")
+
+	var result []string
+	art.MultiRange([]KeyRange{
+		{Begin: nil, End: []byte("12"), IncludeBegin: true, IncludeEnd: true},
+		{Begin: []byte("2"), End: []byte("3"), IncludeBegin: true},
+	}, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		art.Delete(key)
+		return false
+	})
+	assert.Equal([]string{"", "1", "12", "2", "23"}, result)
+	assert.Equal(2, len(collectKeys(art)))
+}
+
+func TestLargeMultiRange(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	rng := rand.New(rand.NewSource(0))
+	bounds := make([]int, 100)
+	for i := range bounds {
+		bounds[i] = rng.Intn(len(keys))
+	}
+	sort.Ints(bounds)
+
+	var ranges []KeyRange
+	var except [][]byte
+	for i := 0; i+1 < len(bounds); i += 2 {
+		b, e := bounds[i], bounds[i+1]
+		if b == e || (i > 0 && b == bounds[i-1]) {
+			continue
+		}
+		ranges = append(ranges, KeyRange{Begin: keys[b], End: keys[e], IncludeBegin: true})
+		except = append(except, keys[b:e]...)
+	}
+
+	var result [][]byte
+	art.MultiRange(ranges, func(key []byte, value interface{}) bool {
+		result = append(result, key)
+		return false
+	})
+	assert.Equal(except, result)
+}
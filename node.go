@@ -124,14 +124,17 @@ type leaf struct {
 	nodeType uint8
 	key      []byte
 	value    interface{}
+
+	// expireAt is the unix nano time this leaf expired at, 0 means never.
+	expireAt int64
 }
 
 func newLeaf(key []byte, value interface{}) *leaf {
 	l := &leaf{
 		nodeType: typeLeaf,
 		key:      key,
-		value:    value,
 	}
+	l.set(value)
 	return l
 }
 
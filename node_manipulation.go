@@ -127,10 +127,18 @@ func min(a, b int) int {
 	return b
 }
 
-func (l *leaf) updateOrExpand(key []byte, value interface{}, depth int, nodeLoc *unsafe.Pointer) {
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// updateOrExpand update the value of l if key match it, and return the replaced value.
+// Otherwise l is expanded to a node4 holding both keys.
+func (l *leaf) updateOrExpand(key []byte, value interface{}, depth int, nodeLoc *unsafe.Pointer) (old interface{}, replaced bool) {
 	if l.match(key) {
-		l.value = value
-		return
+		return l.set(value), true
 	}
 	var (
 		i         int
@@ -156,15 +164,16 @@ func (l *leaf) updateOrExpand(key []byte, value interface{}, depth int, nodeLoc
 		newNode.insertChild(key[i], unsafe.Pointer(newLeaf(key, value)))
 	}
 	atomic.StorePointer(nodeLoc, unsafe.Pointer(newNode))
+	return nil, false
 }
 
-func (n *node) updatePrefixLeaf(key []byte, value interface{}) {
+func (n *node) updatePrefixLeaf(key []byte, value interface{}) (old interface{}, replaced bool) {
 	l := (*leaf)(n.prefixLeaf)
 	if l == nil {
 		atomic.StorePointer(&n.prefixLeaf, unsafe.Pointer(newLeaf(key, value)))
-	} else {
-		l.value = value
+		return nil, false
 	}
+	return l.set(value), true
 }
 
 func (n *node) removeChild(i int) {
@@ -244,6 +253,7 @@ func (n *node4) removeChildAndShrink(key byte, nodeLoc *unsafe.Pointer) bool {
 		}
 	}
 
+	// shouldShrink never let a non-root node4 lose its last entry.
 	panic("opt-art: unreachable code.")
 }
 
@@ -253,25 +263,31 @@ func (n *node4) compressChild(idx int, nodeLoc *unsafe.Pointer) bool {
 		if !child.lock() {
 			return false
 		}
-		prefixLen := n.prefixLen
-		if prefixLen < maxPrefixLen {
-			n.prefix[prefixLen] = n.keys[idx]
-			prefixLen++
-		}
-		if prefixLen < maxPrefixLen {
-			subPrefixLen := min(child.prefixLen, maxPrefixLen-prefixLen)
-			copy(n.prefix[prefixLen:], child.prefix[:subPrefixLen])
-			prefixLen += subPrefixLen
-		}
-
-		copy(child.prefix[:], n.prefix[:min(prefixLen, maxPrefixLen)])
-		child.prefixLen += n.prefixLen + 1
+		n.mergePrefix(n.keys[idx], child)
 		child.unlock()
 	}
 	atomic.StorePointer(nodeLoc, unsafe.Pointer(child))
 	return true
 }
 
+// mergePrefix prepend the prefix of n and the key byte of child to the prefix of child.
+// The caller must hold the lock of n and child.
+func (n *node) mergePrefix(key byte, child *node) {
+	prefixLen := n.prefixLen
+	if prefixLen < maxPrefixLen {
+		n.prefix[prefixLen] = key
+		prefixLen++
+	}
+	if prefixLen < maxPrefixLen {
+		subPrefixLen := min(child.prefixLen, maxPrefixLen-prefixLen)
+		copy(n.prefix[prefixLen:], child.prefix[:subPrefixLen])
+		prefixLen += subPrefixLen
+	}
+
+	copy(child.prefix[:], n.prefix[:min(prefixLen, maxPrefixLen)])
+	child.prefixLen += n.prefixLen + 1
+}
+
 func (n *node16) removeChildAndShrink(key byte, nodeLoc *unsafe.Pointer) bool {
 	newNode := newNode4()
 	idx := 0
@@ -52,74 +52,63 @@ func (n *node) findChild(key byte) (child *node, nodeLoc *unsafe.Pointer, positi
 	return nil, nil, 0
 }
 
-func (n *node) searchOpt(key []byte, depth int, parent *node, parentVersion uint64) (interface{}, bool, bool) {
-	var (
-		version uint64
-		ok      bool
-	)
+// searchOpt lookup key in subtree n, a leaf expired at now is treated as absent.
+func (n *node) searchOpt(key []byte, depth int, parent *node, parentVersion uint64, path *pathCache, now int64) (value interface{}, expireAt int64, ex, ok bool) {
+	var version uint64
 
 RECUR:
 	if version, ok = n.rLock(); !ok {
-		return nil, false, false
+		return nil, 0, false, false
 	}
+	path.push(n, version, depth, nil)
 	if !parent.rUnlock(parentVersion) {
-		return nil, false, false
+		return nil, 0, false, false
 	}
 
 	if n.checkPrefix(key, depth) != min(n.prefixLen, maxPrefixLen) {
 		if !n.rUnlock(version) {
-			return nil, false, false
+			return nil, 0, false, false
 		}
-		return nil, false, true
+		return nil, 0, false, true
 	}
 	depth += n.prefixLen
 
 	if depth == len(key) {
 		l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
-		var (
-			value interface{}
-			ex    bool
-		)
-		if l != nil && l.match(key) {
-			value = l.value
-			ex = true
+		if l != nil && l.match(key) && !l.expired(now) {
+			value, expireAt, ex = l.value, l.expireAt, true
 		}
 		if !n.rUnlock(version) {
-			return nil, false, false
+			return nil, 0, false, false
 		}
-		return value, ex, true
+		return value, expireAt, ex, true
 	}
 
 	if depth > len(key) {
-		return nil, false, n.rUnlock(version)
+		return nil, 0, false, n.rUnlock(version)
 	}
 
 	nextNode, _, _ := n.findChild(key[depth])
 	if !n.lockCheck(version) {
-		return nil, false, false
+		return nil, 0, false, false
 	}
 
 	if nextNode == nil {
 		if !n.rUnlock(version) {
-			return nil, false, false
+			return nil, 0, false, false
 		}
-		return nil, false, true
+		return nil, 0, false, true
 	}
 
 	if nextNode.nodeType == typeLeaf {
 		l := (*leaf)(unsafe.Pointer(nextNode))
-		var (
-			value interface{}
-			ex    bool
-		)
-		if l.match(key) {
-			value = l.value
-			ex = true
+		if l.match(key) && !l.expired(now) {
+			value, expireAt, ex = l.value, l.expireAt, true
 		}
 		if !n.rUnlock(version) {
-			return nil, false, false
+			return nil, 0, false, false
 		}
-		return value, ex, true
+		return value, expireAt, ex, true
 	}
 
 	depth += 1
@@ -208,90 +197,129 @@ func (n *node) prefixMismatch(key []byte, depth int, parent *node, version, pare
 	return i - depth, fullKey, true
 }
 
-func (n *node) insertOpt(key []byte, value interface{}, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer) bool {
+func (n *node) insertOpt(key []byte, value interface{}, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer, path *pathCache, g *guard) (old interface{}, replaced, ok bool) {
 	var (
 		version  uint64
-		ok       bool
 		nextNode *node
 		nextLoc  *unsafe.Pointer
 	)
 
 RECUR:
 	if version, ok = n.rLock(); !ok {
-		return false
+		return nil, false, false
 	}
+	path.push(n, version, depth, nodeLoc)
 
 	p, fullKey, ok := n.prefixMismatch(key, depth, parent, version, parentVersion)
 	if !ok {
-		return false
+		return nil, false, false
 	}
 	if p != n.prefixLen {
 		if !parent.upgradeToLock(parentVersion) {
-			return false
+			return nil, false, false
 		}
 		if !n.upgradeToLockWithNode(version, parent) {
-			return false
+			return nil, false, false
+		}
+		if !g.put(nil) {
+			n.unlock()
+			parent.unlock()
+			return nil, false, true
 		}
 		n.insertSplitPrefix(key, fullKey, value, depth, p, nodeLoc)
 		n.unlock()
 		parent.unlock()
-		return true
+		return nil, false, true
 	}
 	depth += n.prefixLen
 
 	if depth == len(key) {
 		if !n.upgradeToLock(version) {
-			return false
+			return nil, false, false
 		}
 		if !parent.rUnlockWithNode(parentVersion, n) {
-			return false
+			return nil, false, false
+		}
+		l := (*leaf)(n.prefixLeaf)
+		stale := l != nil && g.expired(l)
+		if l != nil && !stale {
+			old = l.value
+		}
+		if !g.put(old) {
+			n.unlock()
+			return nil, false, true
 		}
-		n.updatePrefixLeaf(key, value)
+		old, replaced = n.updatePrefixLeaf(key, value)
 		n.unlock()
-		return true
+		if stale {
+			g.reap(key, old)
+			return nil, false, true
+		}
+		return old, replaced, true
 	}
 
 	nextNode, nextLoc, _ = n.findChild(key[depth])
 	if !n.lockCheck(version) {
-		return false
+		return nil, false, false
 	}
 
 	if nextNode == nil {
 		if n.isFull() {
 			if !parent.upgradeToLock(parentVersion) {
-				return false
+				return nil, false, false
 			}
 			if !n.upgradeToLockWithNode(version, parent) {
-				return false
+				return nil, false, false
+			}
+			if !g.put(nil) {
+				n.unlock()
+				parent.unlock()
+				return nil, false, true
 			}
 			n.growAndInsert(key[depth], unsafe.Pointer(newLeaf(key, value)), nodeLoc)
 			n.unlockObsolete()
 			parent.unlock()
 		} else {
 			if !n.upgradeToLock(version) {
-				return false
+				return nil, false, false
 			}
 			if !parent.rUnlockWithNode(parentVersion, n) {
-				return false
+				return nil, false, false
+			}
+			if !g.put(nil) {
+				n.unlock()
+				return nil, false, true
 			}
 			n.insertChild(key[depth], unsafe.Pointer(newLeaf(key, value)))
 			n.unlock()
 		}
-		return true
+		return nil, false, true
 	}
 
 	if !parent.rUnlock(parentVersion) {
-		return false
+		return nil, false, false
 	}
 
 	if nextNode.nodeType == typeLeaf {
 		if !n.upgradeToLock(version) {
-			return false
+			return nil, false, false
 		}
 		l := (*leaf)(unsafe.Pointer(nextNode))
-		l.updateOrExpand(key, value, depth+1, nextLoc)
+		stale := l.match(key) && g.expired(l)
+		if l.match(key) && !stale {
+			old = l.value
+		}
+		if !g.put(old) {
+			n.unlock()
+			return nil, false, true
+		}
+		old, replaced = l.updateOrExpand(key, value, depth+1, nextLoc)
 		n.unlock()
-		return true
+		if stale {
+			g.reap(key, old)
+			return nil, false, true
+		}
+		return old, replaced, true
 	}
 
 	depth += 1
@@ -302,110 +330,133 @@ RECUR:
 	goto RECUR
 }
 
-func (n *node) removeOpt(key []byte, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer) bool {
-	var (
-		version uint64
-		ok      bool
-	)
+func (n *node) removeOpt(key []byte, depth int, parent *node, parentVersion uint64, nodeLoc *unsafe.Pointer, path *pathCache, g *guard) (old interface{}, removed, ok bool) {
+	var version uint64
 
 RECUR:
 	if version, ok = n.rLock(); !ok {
-		return false
+		return nil, false, false
 	}
+	path.push(n, version, depth, nodeLoc)
 	if !parent.rUnlock(parentVersion) {
-		return false
+		return nil, false, false
 	}
 
 	if n.checkPrefix(key, depth) != min(n.prefixLen, maxPrefixLen) {
-		if !n.rUnlock(version) {
-			return false
-		}
-		return true
+		return nil, false, n.rUnlock(version)
 	}
 	depth += n.prefixLen
 
 	if depth == len(key) {
 		l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
 		if l == nil || !l.match(key) {
-			if !n.rUnlock(version) {
-				return false
-			}
-			return true
+			return nil, false, n.rUnlock(version)
+		}
+		// The value is updated with n locked, so it's validated by the following lock upgrade.
+		old = l.value
+		stale := g.expired(l)
+		if g.reaping() && !stale {
+			return nil, false, n.rUnlock(version)
 		}
 		if n.shouldCompress(parent) {
 			if !parent.upgradeToLock(parentVersion) {
-				return false
+				return nil, false, false
 			}
 			if !n.upgradeToLockWithNode(version, parent) {
-				return false
+				return nil, false, false
+			}
+			if !stale && !g.delete(old) {
+				n.unlock()
+				parent.unlock()
+				return nil, false, true
 			}
 			atomic.StorePointer(&n.prefixLeaf, nil)
 			n4 := (*node4)(unsafe.Pointer(n))
 			if !n4.compressChild(0, nodeLoc) {
 				n.unlock()
 				parent.unlock()
-				return false
+				return nil, false, false
 			}
 			n.unlockObsolete()
 			parent.unlock()
-			return true
 		} else {
 			if !n.upgradeToLock(version) {
-				return false
+				return nil, false, false
+			}
+			if !stale && !g.delete(old) {
+				n.unlock()
+				return nil, false, true
 			}
 			atomic.StorePointer(&n.prefixLeaf, nil)
 			n.unlock()
-			return true
 		}
+		if stale {
+			g.reap(key, old)
+			return nil, false, true
+		}
+		return old, true, true
 	}
 
 	if depth > len(key) {
-		return n.rUnlock(version)
+		return nil, false, n.rUnlock(version)
 	}
 
 	nextNode, nextLoc, idx := n.findChild(key[depth])
 	if !n.lockCheck(version) {
-		return false
+		return nil, false, false
 	}
 
 	if nextNode == nil {
-		if !n.rUnlock(version) {
-			return false
-		}
-		return true
+		return nil, false, n.rUnlock(version)
 	}
 
 	if nextNode.nodeType == typeLeaf {
 		l := (*leaf)(unsafe.Pointer(nextNode))
 		if !l.match(key) {
-			if !n.rUnlock(version) {
-				return false
-			}
-			return true
+			return nil, false, n.rUnlock(version)
+		}
+		old = l.value
+		stale := g.expired(l)
+		if g.reaping() && !stale {
+			return nil, false, n.rUnlock(version)
 		}
 		if n.shouldShrink(parent) {
 			if !parent.upgradeToLock(parentVersion) {
-				return false
+				return nil, false, false
 			}
 			if !n.upgradeToLockWithNode(version, parent) {
-				return false
+				return nil, false, false
+			}
+			if !stale && !g.delete(old) {
+				n.unlock()
+				parent.unlock()
+				return nil, false, true
 			}
 			if !n.removeChildAndShrink(key[depth], nodeLoc) {
 				n.unlock()
 				parent.unlock()
-				return false
+				return nil, false, false
 			}
 			n.unlockObsolete()
 			parent.unlock()
-			return true
 		} else {
 			if !n.upgradeToLock(version) {
-				return false
+				return nil, false, false
+			}
+			if !stale && !g.delete(old) {
+				n.unlock()
+				return nil, false, true
 			}
 			n.removeChild(idx)
+			// n is locked anyway, take the chance to remove it's expired children.
+			n.reapExpired(parent, g)
 			n.unlock()
-			return true
 		}
+		if stale {
+			g.reap(key, old)
+			return nil, false, true
+		}
+		return old, true, true
 	}
 
 	depth += 1
@@ -415,3 +466,161 @@ RECUR:
 	n = nextNode
 	goto RECUR
 }
+
+// popOpt remove the minimal or maximal key in subtree n, and return the removed key and value.
+// All nodes on the path are validated after the removed leaf's node is locked, so the removed
+// key is still the minimal or maximal one at the time it is removed.
+// An expired key is removed into g instead, and ok is false to pop the next one.
+// If the removal is vetoed by before hooks in g, ex is false and ok is true.
+func (n *node) popOpt(maximal bool, nodeLoc *unsafe.Pointer, path *pathCache, g *guard) (key []byte, value interface{}, ex, ok bool) {
+	var (
+		version       uint64
+		parent        *node
+		parentVersion uint64
+	)
+
+RECUR:
+	if version, ok = n.rLock(); !ok {
+		return nil, nil, false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return nil, nil, false, false
+	}
+	path.push(n, version, 0, nodeLoc)
+
+	prefixLeaf := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
+	var (
+		childKey byte
+		child    *node
+	)
+	if maximal {
+		childKey, child = n.childBefore(255)
+	} else {
+		childKey, child = n.childFrom(0)
+	}
+	if !n.lockCheck(version) {
+		return nil, nil, false, false
+	}
+
+	if prefixLeaf != nil && (!maximal || child == nil) {
+		key, value = prefixLeaf.key, prefixLeaf.value
+		stale := g.expired(prefixLeaf)
+		if !n.lockCheck(version) {
+			return nil, nil, false, false
+		}
+		if n.shouldCompress(parent) {
+			if !parent.upgradeToLock(parentVersion) {
+				return nil, nil, false, false
+			}
+			if !n.upgradeToLockWithNode(version, parent) {
+				return nil, nil, false, false
+			}
+			if !path.validate(2) {
+				n.unlock()
+				parent.unlock()
+				return nil, nil, false, false
+			}
+			if !stale && !g.deleteKey(key, value) {
+				n.unlock()
+				parent.unlock()
+				return nil, nil, false, true
+			}
+			if !(*node4)(unsafe.Pointer(n)).compressChild(0, nodeLoc) {
+				n.unlock()
+				parent.unlock()
+				return nil, nil, false, false
+			}
+			atomic.StorePointer(&n.prefixLeaf, nil)
+			n.unlockObsolete()
+			parent.unlock()
+		} else {
+			if !n.upgradeToLock(version) {
+				return nil, nil, false, false
+			}
+			if !path.validate(1) {
+				n.unlock()
+				return nil, nil, false, false
+			}
+			if !stale && !g.deleteKey(key, value) {
+				n.unlock()
+				return nil, nil, false, true
+			}
+			atomic.StorePointer(&n.prefixLeaf, nil)
+			n.unlock()
+		}
+		if stale {
+			g.reap(key, value)
+			return nil, nil, false, false
+		}
+		return key, value, true, true
+	}
+
+	if child == nil {
+		// Only empty root have no child.
+		return nil, nil, false, n.rUnlock(version)
+	}
+
+	_, nextLoc, idx := n.findChild(childKey)
+	if !n.lockCheck(version) {
+		return nil, nil, false, false
+	}
+
+	if child.nodeType == typeLeaf {
+		l := (*leaf)(unsafe.Pointer(child))
+		key, value = l.key, l.value
+		stale := g.expired(l)
+		if !n.lockCheck(version) {
+			return nil, nil, false, false
+		}
+		if n.shouldShrink(parent) {
+			if !parent.upgradeToLock(parentVersion) {
+				return nil, nil, false, false
+			}
+			if !n.upgradeToLockWithNode(version, parent) {
+				return nil, nil, false, false
+			}
+			if !path.validate(2) {
+				n.unlock()
+				parent.unlock()
+				return nil, nil, false, false
+			}
+			if !stale && !g.deleteKey(key, value) {
+				n.unlock()
+				parent.unlock()
+				return nil, nil, false, true
+			}
+			if !n.removeChildAndShrink(childKey, nodeLoc) {
+				n.unlock()
+				parent.unlock()
+				return nil, nil, false, false
+			}
+			n.unlockObsolete()
+			parent.unlock()
+		} else {
+			if !n.upgradeToLock(version) {
+				return nil, nil, false, false
+			}
+			if !path.validate(1) {
+				n.unlock()
+				return nil, nil, false, false
+			}
+			if !stale && !g.deleteKey(key, value) {
+				n.unlock()
+				return nil, nil, false, true
+			}
+			n.removeChild(idx)
+			n.unlock()
+		}
+		if stale {
+			g.reap(key, value)
+			return nil, nil, false, false
+		}
+		return key, value, true, true
+	}
+
+	parent = n
+	parentVersion = version
+	nodeLoc = nextLoc
+	n = child
+	goto RECUR
+}
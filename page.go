@@ -0,0 +1,85 @@
+package art
+
+import (
+	"encoding/binary"
+)
+
+// KV is a key and it's value.
+type KV struct {
+	Key   []byte
+	Value interface{}
+}
+
+// Page return at most limit keys in [begin, end) and their values in ascending order. If end is nil,
+// the range has no upper bound, and if limit is not positive, all keys in range are returned.
+// nextToken is not nil if there are more keys, pass it as token to get the next page. The token
+// records the range and the last returned key, so begin and end are ignored once token is given,
+// and the next page starts after the last returned key even if it has been deleted.
+// An invalid token results in an empty page.
+// This operation is thread safe, keys are never duplicated or skipped by page boundaries.
+func (t *ART) Page(begin, end []byte, limit int, token []byte) (items []KV, nextToken []byte) {
+	it := &iterator{
+		begin:        begin,
+		end:          end,
+		includeBegin: true,
+	}
+	if token != nil {
+		var ok bool
+		if it.begin, it.end, it.prev, ok = decodePageToken(token); !ok {
+			return nil, nil
+		}
+		// Resume the scan like a restart of the previous page.
+		it.setPrev(it.prev)
+	}
+	it.unbounded = it.end == nil
+
+	more := false
+	it.f = func(key []byte, value interface{}) bool {
+		if limit > 0 && len(items) == limit {
+			more = true
+			return true
+		}
+		items = append(items, KV{Key: key, Value: value})
+		return false
+	}
+	t.iterate(it)
+
+	if !more {
+		return items, nil
+	}
+	return items, encodePageToken(it.begin, it.end, items[len(items)-1].Key)
+}
+
+// The token is the concatenation of begin, end and the last returned key, each one is prefixed
+// by it's length plus one as uvarint, and zero length means a nil end.
+func encodePageToken(begin, end, last []byte) []byte {
+	token := make([]byte, 0, len(begin)+len(end)+len(last)+3*binary.MaxVarintLen64)
+	for _, b := range [][]byte{begin, end, last} {
+		if b == nil {
+			token = binary.AppendUvarint(token, 0)
+			continue
+		}
+		token = binary.AppendUvarint(token, uint64(len(b))+1)
+		token = append(token, b...)
+	}
+	return token
+}
+
+func decodePageToken(token []byte) (begin, end, last []byte, ok bool) {
+	var parts [3][]byte
+	for i := range parts {
+		l, n := binary.Uvarint(token)
+		if n <= 0 || l > uint64(len(token)-n)+1 {
+			return nil, nil, nil, false
+		}
+		token = token[n:]
+		if size := int(l) - 1; size >= 0 {
+			parts[i] = token[:size:size]
+			token = token[size:]
+		}
+	}
+	if len(token) != 0 {
+		return nil, nil, nil, false
+	}
+	return parts[0], parts[1], parts[2], true
+}
@@ -0,0 +1,113 @@
+package art
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPage(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	art.Put(nil, nil)
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	b, e := len(keys)/10, len(keys)/10*9
+	var result [][]byte
+	items, token := art.Page(keys[b], keys[e], 100, nil)
+	for {
+		assert.True(len(items) <= 100)
+		for _, item := range items {
+			assert.Equal(item.Key, item.Value)
+			result = append(result, item.Key)
+		}
+		if token == nil {
+			break
+		}
+		assert.Len(items, 100)
+		// The bounds are taken from the token.
+		items, token = art.Page(nil, nil, 100, token)
+	}
+	assert.Equal(keys[b:e], result)
+
+	items, token = art.Page(nil, nil, 0, nil)
+	assert.Nil(token)
+	assert.Len(items, len(keys)+1)
+	assert.Empty(items[0].Key)
+
+	// The page is resumed after the empty key.
+	items, token = art.Page(nil, []byte("a"), 1, nil)
+	assert.Len(items, 1)
+	assert.Empty(items[0].Key)
+	items, _ = art.Page(nil, nil, 1, token)
+	assert.Equal(keys[0], items[0].Key)
+
+	// The page is resumed after the deleted key.
+	items, token = art.Page(keys[0], nil, 1, nil)
+	art.Delete(items[0].Key)
+	items, _ = art.Page(nil, nil, 1, token)
+	assert.Equal(keys[1], items[0].Key)
+
+	items, token = art.Page(nil, nil, 1, []byte{0xff})
+	assert.Nil(items)
+	assert.Nil(token)
+}
+
+func TestConcurrentPutAndPage(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	pivot := len(keys) / 2
+	mustExist, putKeys := keys[:pivot], keys[pivot:]
+	art := NewART()
+	for _, k := range mustExist {
+		art.Put(k, k)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(putKeys); j += 4 {
+				art.Put(putKeys[j], putKeys[j])
+				if j%3 == 0 {
+					art.Delete(putKeys[j])
+				}
+			}
+		}(i)
+	}
+
+	var result [][]byte
+	items, token := art.Page(nil, nil, 7, nil)
+	for {
+		for _, item := range items {
+			result = append(result, item.Key)
+		}
+		if token == nil {
+			break
+		}
+		items, token = art.Page(nil, nil, 7, token)
+	}
+	wg.Wait()
+
+	// Keys are strictly ascending, so no key is duplicated.
+	for i := 1; i < len(result); i++ {
+		assert.True(string(result[i-1]) < string(result[i]))
+	}
+	position := make(map[string]int)
+	for i, k := range mustExist {
+		position[string(k)] = i
+	}
+	pos := 0
+	for _, k := range result {
+		if p, ok := position[string(k)]; ok {
+			assert.Equal(pos, p)
+			pos++
+		}
+	}
+	assert.Equal(len(mustExist), pos)
+}
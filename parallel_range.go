@@ -0,0 +1,150 @@
+package art
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// partitionsPerWorker is the number of partitions created for each worker, smaller partitions
+	// make workers finish at nearly the same time.
+	partitionsPerWorker = 4
+	// maxPartitionDepth is the maximum levels of inner nodes visited to find partition boundaries.
+	maxPartitionDepth = 4
+)
+
+// PartitionOpFunc is ParallelRangePartitioned callback function.
+// Partitions are numbered in key order, so results of each partition can be concatenated in order.
+// If PartitionOpFunc return true the whole query will terminate.
+type PartitionOpFunc func(partition int, key []byte, value interface{}) (end bool)
+
+// ParallelRange iterate the keys in [begin, end) using several goroutines.
+// The range is partitioned at child boundaries of inner nodes, and partitions are scanned
+// concurrently, so f will be called concurrently and keys are not in order.
+// If end is nil, all keys not less than begin will be iterated.
+// This operation is thread safe.
+func (t *ART) ParallelRange(begin, end []byte, workers int, f OpFunc) {
+	t.ParallelRangePartitioned(begin, end, workers, func(_ int, key []byte, value interface{}) bool {
+		return f(key, value)
+	})
+}
+
+// ParallelRangePartitioned is same as ParallelRange, but keys in the same partition are delivered
+// in order by a single goroutine, and the partition number is passed to f.
+// This operation is thread safe.
+func (t *ART) ParallelRangePartitioned(begin, end []byte, workers int, f PartitionOpFunc) {
+	if workers < 1 {
+		workers = 1
+	}
+	bounds := t.partitionKeys(begin, end, workers*partitionsPerWorker)
+	bounds = append([][]byte{begin}, bounds...)
+
+	var (
+		wg      sync.WaitGroup
+		next    int32 = -1
+		stopped int32
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				p := int(atomic.AddInt32(&next, 1))
+				if p >= len(bounds) || atomic.LoadInt32(&stopped) == 1 {
+					return
+				}
+				it := &iterator{
+					begin:        bounds[p],
+					includeBegin: true,
+					f: func(key []byte, value interface{}) bool {
+						if atomic.LoadInt32(&stopped) == 1 {
+							return true
+						}
+						if f(p, key, value) {
+							atomic.StoreInt32(&stopped, 1)
+							return true
+						}
+						return false
+					},
+				}
+				if p+1 < len(bounds) {
+					it.end = bounds[p+1]
+				} else {
+					it.end = end
+					it.unbounded = end == nil
+				}
+				t.iterate(it)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// partitionKeys return at most n-1 sorted keys in (begin, end) which split the range into n
+// partitions. The keys are chosen from paths of inner node's children, the result is
+// only a hint because the tree may be modified concurrently.
+func (t *ART) partitionKeys(begin, end []byte, n int) [][]byte {
+	type entry struct {
+		n    *node
+		path []byte
+	}
+
+	var candidates [][]byte
+	level := []entry{{n: (*node)(atomic.LoadPointer(&t.root))}}
+	for depth := 0; depth < maxPartitionDepth && len(level) > 0 && len(candidates) < n; depth++ {
+		var next []entry
+		for _, e := range level {
+			version, ok := e.n.rLock()
+			if !ok {
+				continue
+			}
+			// Only the first maxPrefixLen bytes of the prefix are stored in the node, the full
+			// prefix is needed or the bound may fall inside the prefix.
+			path, ok := e.n.appendPrefix(append([]byte(nil), e.path...), version, len(e.path))
+			if !ok {
+				continue
+			}
+
+			var children []entry
+			for k := 0; k < 256; {
+				key, child := e.n.childFrom(k)
+				if child == nil {
+					break
+				}
+				p := append(path[:len(path):len(path)], key)
+				children = append(children, entry{n: child, path: p})
+				k = int(key) + 1
+			}
+			if !e.n.rUnlock(version) {
+				continue
+			}
+			for _, c := range children {
+				candidates = append(candidates, c.path)
+				if c.n.nodeType != typeLeaf {
+					next = append(next, c)
+				}
+			}
+		}
+		level = next
+	}
+
+	filtered := candidates[:0]
+	for _, k := range candidates {
+		if bytes.Compare(k, begin) > 0 && (end == nil || bytes.Compare(k, end) < 0) {
+			filtered = append(filtered, k)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return bytes.Compare(filtered[i], filtered[j]) < 0
+	})
+	if len(filtered) < n {
+		return filtered
+	}
+	result := make([][]byte, 0, n-1)
+	for i := 1; i < n; i++ {
+		result = append(result, filtered[i*len(filtered)/n])
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+package art
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelRange(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	var (
+		mu     sync.Mutex
+		result [][]byte
+	)
+	art.ParallelRange(nil, nil, 8, func(key []byte, value interface{}) bool {
+		mu.Lock()
+		result = append(result, key)
+		mu.Unlock()
+		return false
+	})
+	assert.Equal(keys, sortedKeys(result))
+
+	b, e := len(keys)/10, len(keys)/10*9
+	partitions := make(map[int][][]byte)
+	art.ParallelRangePartitioned(keys[b], keys[e], 4, func(p int, key []byte, value interface{}) bool {
+		mu.Lock()
+		partitions[p] = append(partitions[p], key)
+		mu.Unlock()
+		return false
+	})
+	assert.True(len(partitions) > 1)
+	result = result[:0]
+	for p := 0; p < len(partitions); p++ {
+		result = append(result, partitions[p]...)
+	}
+	assert.Equal(keys[b:e], result)
+}
+
+func TestParallelRangeTerminate(t *testing.T) {
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	var count int32
+	art.ParallelRange([]byte("a"), []byte("b"), 4, func(key []byte, value interface{}) bool {
+		return atomic.AddInt32(&count, 1) >= 10
+	})
+	// Each worker may finish its current key after the termination.
+	assert.True(t, count >= 10 && count < 20)
+}
+
+func TestParallelRangeSmallTree(t *testing.T) {
+	assert := assert.New(t)
+	var result []string
+	var mu sync.Mutex
+	f := func(key []byte, value interface{}) bool {
+		mu.Lock()
+		result = append(result, string(key))
+		mu.Unlock()
+		return false
+	}
+
+	NewART().ParallelRange(nil, nil, 4, f)
+	assert.Empty(result)
+
+	newARTWithKeys("abc", "abd", "abcdefghijklmn").ParallelRange([]byte("abc"), nil, 4, f)
+	sort.Strings(result)
+	assert.Equal([]string{"abc", "abcdefghijklmn", "abd"}, result)
+}
+
+func TestParallelRangeLongPrefix(t *testing.T) {
+	assert := assert.New(t)
+	randKey := func(rng *rand.Rand, bases []string) []byte {
+		key := []byte(bases[rng.Intn(len(bases))])
+		for i := rng.Intn(4); i > 0; i-- {
+			key = append(key, "abc"[rng.Intn(3)])
+		}
+		return key[:rng.Intn(len(key)+1)]
+	}
+	for seed := int64(0); seed < 50; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		// Long shared prefixes are compressed into nodes holding more than maxPrefixLen bytes.
+		var bases []string
+		for i := 0; i < 4; i++ {
+			base := strings.Repeat(string("abc"[i%3]), 5+rng.Intn(20))
+			bases = append(bases, base, base+strings.Repeat("b", 10+rng.Intn(10)))
+		}
+		art := NewART()
+		set := make(map[string]struct{})
+		for i := 0; i < 200; i++ {
+			key := randKey(rng, bases)
+			art.Put(key, nil)
+			set[string(key)] = struct{}{}
+		}
+
+		begin, end := randKey(rng, bases), randKey(rng, bases)
+		if bytes.Compare(begin, end) > 0 {
+			begin, end = end, begin
+		}
+		var expected []string
+		for k := range set {
+			if k >= string(begin) && k < string(end) {
+				expected = append(expected, k)
+			}
+		}
+		sort.Strings(expected)
+
+		var inRange []string
+		art.Range(begin, end, true, false, func(key []byte, value interface{}) bool {
+			inRange = append(inRange, string(key))
+			return false
+		})
+		assert.Equal(expected, inRange, "seed %d", seed)
+
+		var (
+			mu     sync.Mutex
+			result []string
+		)
+		art.ParallelRange(begin, end, 4, func(key []byte, value interface{}) bool {
+			mu.Lock()
+			result = append(result, string(key))
+			mu.Unlock()
+			return false
+		})
+		sort.Strings(result)
+		assert.Equal(expected, result, "seed %d", seed)
+	}
+}
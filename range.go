@@ -2,6 +2,7 @@ package art
 
 import (
 	"bytes"
+	"context"
 	"sync/atomic"
 	"unsafe"
 )
@@ -18,9 +19,57 @@ type iterator struct {
 	includeEnd   bool
 	k            int
 
+	// unbounded means there is no end key.
+	unbounded bool
+
+	// ctx is polled every ctxCheckInterval accessed children, iterate will stop and
+	// record the error in err once ctx is done.
+	ctx   context.Context
+	err   error
+	count int
+
+	// scan means keys and values are filled into buffer instead of passed to f.
+	scan bool
+	buf  scanBuffer
+
+	// now is the time keys are checked for expiration.
+	now int64
+
 	f OpFunc
 }
 
+const ctxCheckInterval = 64
+
+func (it *iterator) canceled() bool {
+	if it.ctx == nil {
+		return false
+	}
+	it.count++
+	if it.count%ctxCheckInterval != 0 {
+		return false
+	}
+	it.err = it.ctx.Err()
+	return it.err != nil
+}
+
+// setPrev record key as the last applied key. The empty key is recorded as a non-nil slice,
+// because nil prev means nothing is applied yet.
+func (it *iterator) setPrev(key []byte) {
+	if key == nil {
+		key = []byte{}
+	}
+	it.prev = key
+}
+
+// apply record key as prev and pass it to f or the scan buffer.
+func (it *iterator) apply(key []byte, value interface{}) bool {
+	it.setPrev(key)
+	if it.scan {
+		return it.buf.add(key, value)
+	}
+	return it.f(key, value)
+}
+
 func (it *iterator) getBegin() []byte {
 	if it.prev == nil {
 		return it.begin
@@ -62,16 +111,13 @@ func (n *node) fullCompare(version uint64, key []byte, depth int) (int, bool) {
 	remain := len(key) - depth
 	checkLen := min(n.prefixLen, min(maxPrefixLen, remain))
 	cmp := bytes.Compare(n.prefix[:checkLen], key[depth:depth+checkLen])
-	if cmp == 0 {
-		needFull := remain > maxPrefixLen && n.prefixLen > maxPrefixLen
-		if needFull {
-			fullKey, ok := n.fullKey(version)
-			if !ok {
-				return 0, false
-			}
-			l := min(n.prefixLen, len(key))
-			cmp = bytes.Compare(fullKey[depth+checkLen:depth+l], key[depth+checkLen:depth+l])
+	if l := min(n.prefixLen, remain); cmp == 0 && l > checkLen {
+		// The rest of the prefix is not stored in n, recover it from the key of a leaf.
+		fullKey, ok := n.fullKey(version)
+		if !ok {
+			return 0, false
 		}
+		cmp = bytes.Compare(fullKey[depth+checkLen:depth+l], key[depth+checkLen:depth+l])
 	}
 	if cmp == 0 {
 		if n.prefixLen > remain {
@@ -95,15 +141,19 @@ func (n *node) iterOpt(it *iterator, depth int, parent *node, parentVersion uint
 		if beginCmp, ok = n.fullCompare(version, it.getBegin(), depth); !ok {
 			return false, false
 		}
-	} else if beginCmp < 0 {
-		return false, true
+	}
+	if beginCmp < 0 {
+		// All keys in n are less than begin.
+		return false, n.rUnlock(version)
 	}
 	if endCmp == 0 {
 		if endCmp, ok = n.fullCompare(version, it.getEnd(), depth); !ok {
 			return false, false
 		}
-	} else if endCmp > 0 {
-		return true, true
+	}
+	if endCmp > 0 {
+		// All keys in n are greater than end.
+		return true, n.rUnlock(version)
 	}
 	depth += n.prefixLen
 
@@ -117,7 +167,7 @@ func (n *node) iterOpt(it *iterator, depth int, parent *node, parentVersion uint
 		}
 	}
 	if endCmp == 0 && depth == len(it.getEnd()) {
-		usePrefixLeaf = it.isIncludeEnd()
+		usePrefixLeaf = usePrefixLeaf && it.isIncludeEnd()
 		endCmp = 1
 	}
 
@@ -126,12 +176,11 @@ func (n *node) iterOpt(it *iterator, depth int, parent *node, parentVersion uint
 		return false, false
 	}
 	if usePrefixLeaf && prefixLeaf != nil {
-		k, v := prefixLeaf.key, prefixLeaf.value
+		k, v, dead := prefixLeaf.key, prefixLeaf.value, prefixLeaf.expired(it.now)
 		if !n.lockCheck(version) {
 			return false, false
 		}
-		it.prev = k
-		if it.f(k, v) {
+		if !dead && it.apply(k, v) {
 			return true, true
 		}
 	}
@@ -188,7 +237,7 @@ func (n *node4) iterChild(it *iterator, version uint64, depth, beginCmp, endCmp
 			return true, true
 		}
 	}
-	return false, true
+	return false, n.lockCheck(version)
 }
 
 func (n *node16) iterChild(it *iterator, version uint64, depth, beginCmp, endCmp int) (end, cont bool) {
@@ -218,7 +267,7 @@ func (n *node16) iterChild(it *iterator, version uint64, depth, beginCmp, endCmp
 			return true, true
 		}
 	}
-	return false, true
+	return false, n.lockCheck(version)
 }
 
 func (n *node48) iterChild(it *iterator, version uint64, depth, beginCmp, endCmp int) (end, cont bool) {
@@ -253,7 +302,7 @@ func (n *node48) iterChild(it *iterator, version uint64, depth, beginCmp, endCmp
 		}
 
 	}
-	return false, true
+	return false, n.lockCheck(version)
 }
 
 func (n *node256) iterChild(it *iterator, version uint64, depth, beginCmp, endCmp int) (end, cont bool) {
@@ -283,13 +332,16 @@ func (n *node256) iterChild(it *iterator, version uint64, depth, beginCmp, endCm
 			return true, true
 		}
 	}
-	return false, true
+	return false, n.lockCheck(version)
 }
 
 func (it *iterator) accessChild(n *node, child *node, version uint64, depth, beginCmp, endCmp int, bkey, ekey, key byte) (end, ok bool) {
+	if it.canceled() {
+		return true, true
+	}
 	if child.nodeType == typeLeaf {
 		l := (*leaf)(unsafe.Pointer(child))
-		k, v := l.key, l.value
+		k, v, dead := l.key, l.value, l.expired(it.now)
 		if !n.lockCheck(version) {
 			return false, false
 		}
@@ -305,8 +357,10 @@ func (it *iterator) accessChild(n *node, child *node, version uint64, depth, beg
 				return true, true
 			}
 		}
-		it.prev = k
-		return it.f(k, v), true
+		if dead {
+			return false, true
+		}
+		return it.apply(k, v), true
 	} else {
 		if beginCmp == 0 && key > bkey {
 			beginCmp = 1
@@ -318,6 +372,7 @@ func (it *iterator) accessChild(n *node, child *node, version uint64, depth, beg
 	}
 }
 
+// firstChild return the child with the smallest key byte, or nil if n has no child.
 func (n *node) firstChild() *node {
 	switch n.nodeType {
 	case typeNode4:
@@ -345,47 +400,49 @@ func (n *node) firstChild() *node {
 			}
 		}
 	}
-	panic("opt-art: unreachable code.")
+	return nil
 }
 
-func (n *node) minimalOpt(parent *node, parentVersion uint64) ([]byte, interface{}, bool) {
-	var (
-		version uint64
-		ok      bool
-	)
+// minimalOpt find the minimal key in subtree n, ex is false if the subtree is empty,
+// which only happens on an empty root.
+func (n *node) minimalOpt(parent *node, parentVersion uint64) (key []byte, value interface{}, ex, ok bool) {
+	var version uint64
 
 RECUR:
 	if version, ok = n.rLock(); !ok {
-		return nil, nil, false
+		return nil, nil, false, false
 	}
 	if !parent.rUnlock(parentVersion) {
-		return nil, nil, false
+		return nil, nil, false, false
 	}
 
 	prefixLeaf := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
 	if !n.lockCheck(version) {
-		return nil, nil, false
+		return nil, nil, false, false
 	}
 	if prefixLeaf != nil {
-		k, v := prefixLeaf.key, prefixLeaf.value
-		if !n.lockCheck(version) {
-			return nil, nil, false
+		key, value = prefixLeaf.key, prefixLeaf.value
+		if !n.rUnlock(version) {
+			return nil, nil, false, false
 		}
-		return k, v, true
+		return key, value, true, true
 	}
 
 	child := n.firstChild()
 	if !n.lockCheck(version) {
-		return nil, nil, false
+		return nil, nil, false, false
+	}
+	if child == nil {
+		return nil, nil, false, n.rUnlock(version)
 	}
 
 	if child.nodeType == typeLeaf {
 		l := (*leaf)(unsafe.Pointer(child))
-		k, v := l.key, l.value
-		if !n.lockCheck(version) {
-			return nil, nil, false
+		key, value = l.key, l.value
+		if !n.rUnlock(version) {
+			return nil, nil, false, false
 		}
-		return k, v, true
+		return key, value, true, true
 	}
 
 	parent = n
@@ -394,14 +451,19 @@ RECUR:
 	goto RECUR
 }
 
+// lastChild return the child with the largest key byte, or nil if n has no child.
 func (n *node) lastChild() *node {
 	switch n.nodeType {
 	case typeNode4:
 		n4 := (*node4)(unsafe.Pointer(n))
-		return (*node)(atomic.LoadPointer(&n4.children[n4.numChildren-1]))
+		if num := n4.numChildren; num > 0 && num <= 4 {
+			return (*node)(atomic.LoadPointer(&n4.children[num-1]))
+		}
 	case typeNode16:
 		n16 := (*node16)(unsafe.Pointer(n))
-		return (*node)(atomic.LoadPointer(&n16.children[n16.numChildren-1]))
+		if num := n16.numChildren; num > 0 && num <= 16 {
+			return (*node)(atomic.LoadPointer(&n16.children[num-1]))
+		}
 	case typeNode48:
 		n48 := (*node48)(unsafe.Pointer(n))
 		for i := 255; i >= 0; i-- {
@@ -421,35 +483,49 @@ func (n *node) lastChild() *node {
 			}
 		}
 	}
-	panic("opt-art: unreachable code.")
+	return nil
 }
 
-func (n *node) maximalOpt(parent *node, parentVersion uint64) ([]byte, interface{}, bool) {
-	var (
-		version uint64
-		ok      bool
-	)
+// maximalOpt find the maximal key in subtree n, ex is false if the subtree is empty,
+// which only happens on an empty root.
+func (n *node) maximalOpt(parent *node, parentVersion uint64) (key []byte, value interface{}, ex, ok bool) {
+	var version uint64
 
 RECUR:
 	if version, ok = n.rLock(); !ok {
-		return nil, nil, false
+		return nil, nil, false, false
 	}
 	if !parent.rUnlock(parentVersion) {
-		return nil, nil, false
+		return nil, nil, false, false
 	}
 
 	child := n.lastChild()
 	if !n.lockCheck(version) {
-		return nil, nil, false
+		return nil, nil, false, false
+	}
+	if child == nil {
+		// A node without child may still have the prefix key, e.g. root only contains empty key.
+		prefixLeaf := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
+		if !n.lockCheck(version) {
+			return nil, nil, false, false
+		}
+		if prefixLeaf == nil {
+			return nil, nil, false, n.rUnlock(version)
+		}
+		key, value = prefixLeaf.key, prefixLeaf.value
+		if !n.rUnlock(version) {
+			return nil, nil, false, false
+		}
+		return key, value, true, true
 	}
 
 	if child.nodeType == typeLeaf {
 		l := (*leaf)(unsafe.Pointer(child))
-		k, v := l.key, l.value
-		if !n.lockCheck(version) {
-			return nil, nil, false
+		key, value = l.key, l.value
+		if !n.rUnlock(version) {
+			return nil, nil, false, false
 		}
-		return k, v, true
+		return key, value, true, true
 	}
 
 	parent = n
@@ -457,3 +533,147 @@ RECUR:
 	n = child
 	goto RECUR
 }
+
+// prefixBoundOpt find the minimal or maximal key which has the given prefix.
+func (n *node) prefixBoundOpt(prefix []byte, maximal bool) (key []byte, value interface{}, ex, ok bool) {
+	var (
+		version       uint64
+		parent        *node
+		parentVersion uint64
+		depth         int
+	)
+
+RECUR:
+	if version, ok = n.rLock(); !ok {
+		return nil, nil, false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return nil, nil, false, false
+	}
+
+	if n.checkPrefix(prefix, depth) != min(len(prefix)-depth, min(n.prefixLen, maxPrefixLen)) {
+		return nil, nil, false, n.rUnlock(version)
+	}
+
+	if depth+n.prefixLen >= len(prefix) {
+		if maximal {
+			key, value, ex, ok = n.maximalOpt(parent, parentVersion)
+		} else {
+			key, value, ex, ok = n.minimalOpt(parent, parentVersion)
+		}
+		if !ok || !ex {
+			return nil, nil, false, ok
+		}
+		// The optimistic prefix only checked at most maxPrefixLen bytes.
+		return key, value, bytes.HasPrefix(key, prefix), true
+	}
+	depth += n.prefixLen
+
+	child, _, _ := n.findChild(prefix[depth])
+	if !n.lockCheck(version) {
+		return nil, nil, false, false
+	}
+	if child == nil {
+		return nil, nil, false, n.rUnlock(version)
+	}
+	if child.nodeType == typeLeaf {
+		l := (*leaf)(unsafe.Pointer(child))
+		key, value = l.key, l.value
+		if !n.rUnlock(version) {
+			return nil, nil, false, false
+		}
+		return key, value, bytes.HasPrefix(key, prefix), true
+	}
+
+	depth++
+	parent = n
+	parentVersion = version
+	n = child
+	goto RECUR
+}
+
+// prefixSuccessor return the smallest key which is greater than all keys having the given prefix,
+// bounded is false if there is no such key.
+func prefixSuccessor(prefix []byte) (end []byte, bounded bool) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			end = make([]byte, i+1)
+			copy(end, prefix)
+			end[i]++
+			return end, true
+		}
+	}
+	return nil, false
+}
+
+// childFrom return the first child whose key is not less than from, child is nil if there is no such child.
+// The caller must check version of n before using the result.
+func (n *node) childFrom(from int) (byte, *node) {
+	switch n.nodeType {
+	case typeNode4:
+		n4 := (*node4)(unsafe.Pointer(n))
+		for i := 0; i < int(n4.numChildren) && i < 4; i++ {
+			if int(n4.keys[i]) >= from {
+				return n4.keys[i], (*node)(atomic.LoadPointer(&n4.children[i]))
+			}
+		}
+	case typeNode16:
+		n16 := (*node16)(unsafe.Pointer(n))
+		for i := 0; i < int(n16.numChildren) && i < 16; i++ {
+			if int(n16.keys[i]) >= from {
+				return n16.keys[i], (*node)(atomic.LoadPointer(&n16.children[i]))
+			}
+		}
+	case typeNode48:
+		n48 := (*node48)(unsafe.Pointer(n))
+		for key := from; key < 256; key++ {
+			if pos := n48.index[key]; pos > 0 {
+				return byte(key), (*node)(atomic.LoadPointer(&n48.children[pos-1]))
+			}
+		}
+	case typeNode256:
+		n256 := (*node256)(unsafe.Pointer(n))
+		for key := from; key < 256; key++ {
+			if c := atomic.LoadPointer(&n256.children[key]); c != nil {
+				return byte(key), (*node)(c)
+			}
+		}
+	}
+	return 0, nil
+}
+
+// childBefore return the last child whose key is not greater than from, child is nil if there is no such child.
+// The caller must check version of n before using the result.
+func (n *node) childBefore(from int) (byte, *node) {
+	switch n.nodeType {
+	case typeNode4:
+		n4 := (*node4)(unsafe.Pointer(n))
+		for i := min(int(n4.numChildren), 4) - 1; i >= 0; i-- {
+			if int(n4.keys[i]) <= from {
+				return n4.keys[i], (*node)(atomic.LoadPointer(&n4.children[i]))
+			}
+		}
+	case typeNode16:
+		n16 := (*node16)(unsafe.Pointer(n))
+		for i := min(int(n16.numChildren), 16) - 1; i >= 0; i-- {
+			if int(n16.keys[i]) <= from {
+				return n16.keys[i], (*node)(atomic.LoadPointer(&n16.children[i]))
+			}
+		}
+	case typeNode48:
+		n48 := (*node48)(unsafe.Pointer(n))
+		for key := from; key >= 0; key-- {
+			if pos := n48.index[key]; pos > 0 {
+				return byte(key), (*node)(atomic.LoadPointer(&n48.children[pos-1]))
+			}
+		}
+	case typeNode256:
+		n256 := (*node256)(unsafe.Pointer(n))
+		for key := from; key >= 0; key-- {
+			if c := atomic.LoadPointer(&n256.children[key]); c != nil {
+				return byte(key), (*node)(c)
+			}
+		}
+	}
+	return 0, nil
+}
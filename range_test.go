@@ -92,9 +92,9 @@ func TestSimpleRange(t *testing.T) {
 		assert.Equal(except[i], result[i])
 	}
 
-	_, minV := art.Min()
+	_, minV, _ := art.Min()
 	assert.Equal("1234", minV)
-	_, maxV := art.Max()
+	_, maxV, _ := art.Max()
 	assert.Equal("333", maxV)
 
 	result = result[:0]
@@ -130,6 +130,25 @@ func TestLongBeginAndEnd(t *testing.T) {
 	}
 }
 
+func TestBoundInsideLongPrefix(t *testing.T) {
+	assert := assert.New(t)
+	// "a" is followed by a node whose prefix is longer than maxPrefixLen.
+	art := newARTWithKeys("aaaaaaaaaaaabbbbbbbbbbbb", "aaaaaaaaaaaabbbbbbbbbbbbaba", "c", "xc")
+
+	var result []string
+	f := func(key []byte, value interface{}) bool {
+		result = append(result, value.(string))
+		return false
+	}
+	art.Range([]byte("aaaaaaaaaaaaaaa"), []byte("aaaaaaaaaaaabbbbbbbbbbb"), true, false, f)
+	assert.Empty(result)
+	art.Range([]byte("aaaaaaaaaaaabbbbbbbbbbbbab"), []byte("aaaaaaaaaaaabbbbbbbbbbbbb"), true, false, f)
+	assert.Equal([]string{"aaaaaaaaaaaabbbbbbbbbbbbaba"}, result)
+	result = result[:0]
+	art.Range([]byte("c"), []byte("x"), true, false, f)
+	assert.Equal([]string{"c"}, result)
+}
+
 func TestLargeRange(t *testing.T) {
 	assert := assert.New(t)
 	keys := loadTestData("words.txt", nil)
@@ -206,3 +225,165 @@ func TestConcurrentPutAndRange(t *testing.T) {
 		}
 	}
 }
+
+func TestMutateInRange(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	art.Put(nil, "")
+	for _, k := range keys {
+		art.Put(k, string(k))
+	}
+
+	// Rewrite the value of every key.
+	count := 0
+	art.Prefix(nil, func(key []byte, value interface{}) bool {
+		assert.Equal(string(key), value)
+		art.Put(key, value.(string)+"!")
+		count++
+		return false
+	})
+	assert.Equal(len(keys)+1, count)
+
+	// Delete every visited key, and the key next to it.
+	var result [][]byte
+	art.Prefix(nil, func(key []byte, value interface{}) bool {
+		assert.Equal(string(key)+"!", value)
+		result = append(result, key)
+		art.Delete(key)
+		if len(key) > 0 {
+			art.Delete(append(key[:len(key):len(key)], 'a'))
+		}
+		return false
+	})
+	expected := [][]byte{nil}
+	for _, k := range keys {
+		if l := len(expected) - 1; l > 0 && string(k) == string(expected[l])+"a" {
+			continue
+		}
+		expected = append(expected, k)
+	}
+	assert.Equal(len(expected), len(result))
+	for i := range expected {
+		assert.Equal(string(expected[i]), string(result[i]))
+	}
+	_, _, ok := art.Min()
+	assert.False(ok)
+
+	// Keys added ahead of the current key are visited.
+	art = newARTWithKeys("a")
+	result = result[:0]
+	art.Range([]byte("a"), []byte("aaaaa"), true, true, func(key []byte, value interface{}) bool {
+		result = append(result, key)
+		art.Put(append(key[:len(key):len(key)], 'a'), nil)
+		art.Put([]byte(""), nil)
+		return false
+	})
+	assert.Equal([][]byte{[]byte("a"), []byte("aa"), []byte("aaa"), []byte("aaaa"), []byte("aaaaa")}, result)
+}
+
+func TestEmptyTree(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+
+	_, _, ok := art.Min()
+	assert.False(ok)
+	_, _, ok = art.Max()
+	assert.False(ok)
+	art.Range(nil, []byte("a"), true, true, func(key []byte, value interface{}) bool {
+		assert.Fail("unexpected key", "%v", key)
+		return false
+	})
+	art.Prefix(nil, func(key []byte, value interface{}) bool {
+		assert.Fail("unexpected key", "%v", key)
+		return false
+	})
+
+	art.Put(nil, "empty")
+	k, v, ok := art.Min()
+	assert.True(ok)
+	assert.Empty(k)
+	assert.Equal("empty", v)
+	k, v, ok = art.Max()
+	assert.True(ok)
+	assert.Empty(k)
+	assert.Equal("empty", v)
+
+	art.Put([]byte("a"), "a")
+	art.Delete([]byte("a"))
+	art.Delete(nil)
+	_, _, ok = art.Min()
+	assert.False(ok)
+	_, _, ok = art.Max()
+	assert.False(ok)
+}
+
+func TestPopMinAndMax(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	for i, j := 0, len(keys)-1; i <= j; i, j = i+1, j-1 {
+		k, v, ok := art.PopMin()
+		assert.True(ok)
+		assert.Equal(keys[i], k)
+		assert.Equal(keys[i], v)
+		if i == j {
+			break
+		}
+		k, v, ok = art.PopMax()
+		assert.True(ok)
+		assert.Equal(keys[j], k)
+		assert.Equal(keys[j], v)
+	}
+	_, _, ok := art.PopMin()
+	assert.False(ok)
+	_, _, ok = art.PopMax()
+	assert.False(ok)
+
+	art = newARTWithKeys("", "a", "ab", "abcdefghijklmn", "abcdefghijklmo")
+	var result []string
+	for k, _, ok := art.PopMax(); ok; k, _, ok = art.PopMax() {
+		result = append(result, string(k))
+	}
+	assert.Equal([]string{"abcdefghijklmo", "abcdefghijklmn", "ab", "a", ""}, result)
+}
+
+func TestConcurrentPopMin(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	sz := runtime.GOMAXPROCS(0)
+	results := make([][][]byte, sz)
+	var wg sync.WaitGroup
+	for i := 0; i < sz; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				k, _, ok := art.PopMin()
+				if !ok {
+					return
+				}
+				if len(results[i]) > 0 {
+					assert.True(bytes.Compare(results[i][len(results[i])-1], k) < 0)
+				}
+				results[i] = append(results[i], k)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var all [][]byte
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	assert.Equal(sortedKeys(keys), sortedKeys(all))
+}
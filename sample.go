@@ -0,0 +1,195 @@
+package art
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Sample return a key and it's value chosen uniformly at random, key and value are nil if
+// this tree is empty.
+// Sample count keys of every subtree by visiting every inner node once, then walk from root and
+// select child with probability proportional to it's number of keys, so every walk reach a key
+// and leaves under small nodes are not favored. The counting take O(N) time and memory for a tree
+// of N keys on every call, use SampleN to draw many samples with one counting.
+// This operation is thread safe, but the result is only approximately uniform if the tree is
+// modified concurrently.
+func (t *ART) Sample(rng *rand.Rand) ([]byte, interface{}) {
+	keys, values := t.SampleN(rng, 1)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys[0], values[0]
+}
+
+// SampleN return n keys and their values chosen uniformly and independently at random,
+// so a key may appear more than once. The result is empty if this tree is empty or n is not positive.
+// Like Sample, keys of every subtree are counted once for the whole batch, which take O(N) time
+// and memory for a tree of N keys, and they are counted again only if concurrent writers remove
+// a chosen subtree. Each sample then cost a walk from root to a leaf.
+// This operation is thread safe.
+func (t *ART) SampleN(rng *rand.Rand, n int) ([][]byte, []interface{}) {
+	if n <= 0 {
+		return nil, nil
+	}
+	// Expired keys are not counted, so they are never sampled.
+	now := t.now()
+	sizes, total := t.subtreeSizes(now)
+
+	keys, values := make([][]byte, 0, n), make([]interface{}, 0, n)
+	for len(keys) < n {
+		root := (*node)(atomic.LoadPointer(&t.root))
+		key, value, found, ok := root.weightedWalkOpt(rng, sizes, now)
+		if !ok {
+			continue
+		}
+		if !found {
+			// Keys counted in sizes may be removed by concurrent writers, count again.
+			if sizes, total = t.subtreeSizes(now); total == 0 {
+				break
+			}
+			continue
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+// subtreeSizes return the number of keys not expired at now in every inner node, and in the tree.
+func (t *ART) subtreeSizes(now int64) (map[*node]int, int) {
+	for {
+		root := (*node)(atomic.LoadPointer(&t.root))
+		sizes := make(map[*node]int)
+		if total, ok := root.subtreeSizesOpt(nil, 0, sizes, now); ok {
+			return sizes, total
+		}
+	}
+}
+
+// subtreeSizesOpt record the number of keys not expired at now in every inner node of subtree n
+// into sizes, and return the number of such keys in n.
+func (n *node) subtreeSizesOpt(parent *node, parentVersion uint64, sizes map[*node]int, now int64) (int, bool) {
+	version, ok := n.rLock()
+	if !ok {
+		return 0, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return 0, false
+	}
+
+	size := 0
+	if l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf)); l != nil && !l.expired(now) {
+		size++
+	}
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return 0, false
+		}
+		if child == nil {
+			break
+		}
+		if child.nodeType == typeLeaf {
+			if !(*leaf)(unsafe.Pointer(child)).expired(now) {
+				size++
+			}
+		} else {
+			s, ok := child.subtreeSizesOpt(n, version, sizes, now)
+			if !ok {
+				return 0, false
+			}
+			size += s
+		}
+		next = int(key) + 1
+	}
+	sizes[n] = size
+	return size, n.rUnlock(version)
+}
+
+// weight return the number of keys not expired at now in child recorded in sizes.
+// A node created after sizes is computed is counted as one key.
+func weight(child *node, sizes map[*node]int, now int64) int {
+	if child.nodeType == typeLeaf {
+		if (*leaf)(unsafe.Pointer(child)).expired(now) {
+			return 0
+		}
+		return 1
+	}
+	if s, ok := sizes[child]; ok {
+		return s
+	}
+	return 1
+}
+
+// weightedWalkOpt walk from n to a leaf by choosing child with probability proportional to
+// it's size in sizes. found is false if there is no key not expired at now in the chosen subtree.
+func (n *node) weightedWalkOpt(rng *rand.Rand, sizes map[*node]int, now int64) (key []byte, value interface{}, found, ok bool) {
+	var (
+		version       uint64
+		parent        *node
+		parentVersion uint64
+	)
+
+RECUR:
+	if version, ok = n.rLock(); !ok {
+		return nil, nil, false, false
+	}
+	if !parent.rUnlock(parentVersion) {
+		return nil, nil, false, false
+	}
+
+	prefixLeaf := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
+	if prefixLeaf != nil && prefixLeaf.expired(now) {
+		prefixLeaf = nil
+	}
+	total := 0
+	if prefixLeaf != nil {
+		total++
+	}
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return nil, nil, false, false
+		}
+		if child == nil {
+			break
+		}
+		total += weight(child, sizes, now)
+		next = int(key) + 1
+	}
+	if total == 0 {
+		return nil, nil, false, n.rUnlock(version)
+	}
+
+	r := rng.Intn(total)
+	if prefixLeaf != nil {
+		if r == 0 {
+			key, value = prefixLeaf.key, prefixLeaf.value
+			return key, value, true, n.rUnlock(version)
+		}
+		r--
+	}
+	var child *node
+	for next := 0; next < 256; {
+		var k byte
+		k, child = n.childFrom(next)
+		if !n.lockCheck(version) || child == nil {
+			return nil, nil, false, false
+		}
+		if r -= weight(child, sizes, now); r < 0 {
+			break
+		}
+		next = int(k) + 1
+	}
+	if child.nodeType == typeLeaf {
+		l := (*leaf)(unsafe.Pointer(child))
+		key, value = l.key, l.value
+		return key, value, true, n.rUnlock(version)
+	}
+
+	parent = n
+	parentVersion = version
+	n = child
+	goto RECUR
+}
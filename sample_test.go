@@ -0,0 +1,85 @@
+package art
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleUniform(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	// Keys under a shallow and small node4, and keys under a deep and large node256,
+	// a naive random walk will favor the former.
+	shallow := []string{"a", "b", "c"}
+	for _, k := range shallow {
+		art.Put([]byte(k), k)
+	}
+	var keys []string
+	for i := 0; i < 256; i++ {
+		keys = append(keys, fmt.Sprintf("z%c", byte(i)))
+	}
+	for _, k := range keys {
+		art.Put([]byte(k), k)
+	}
+	keys = append(keys, shallow...)
+
+	rng := rand.New(rand.NewSource(0))
+	n := 100 * len(keys)
+	counts := make(map[string]int)
+	sampledKeys, values := art.SampleN(rng, n)
+	assert.Len(sampledKeys, n)
+	for i, k := range sampledKeys {
+		assert.Equal(string(k), values[i])
+		counts[string(k)]++
+	}
+
+	shallowCount := 0
+	for _, k := range shallow {
+		shallowCount += counts[k]
+	}
+	// Except 300 samples of shallow keys, the standard deviation is about 17.
+	assert.True(shallowCount > 200 && shallowCount < 400, "shallow keys sampled %d times", shallowCount)
+	assert.Len(counts, len(keys))
+}
+
+func TestSampleEmpty(t *testing.T) {
+	assert := assert.New(t)
+	rng := rand.New(rand.NewSource(0))
+	k, v := NewART().Sample(rng)
+	assert.Nil(k)
+	assert.Nil(v)
+
+	art := newARTWithKeys("", "a")
+	for i := 0; i < 10; i++ {
+		_, v := art.Sample(rng)
+		assert.NotNil(v)
+	}
+}
+
+func TestSampleDeepTree(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	// Every key is the prefix of the next one, so the tree is a chain of 40 levels.
+	key := []byte{}
+	for i := 0; i < 40; i++ {
+		key = append(key, 'a')
+		art.Put(key, len(key))
+	}
+
+	rng := rand.New(rand.NewSource(0))
+	counts := make(map[int]int)
+	_, values := art.SampleN(rng, 40*100)
+	for _, v := range values {
+		counts[v.(int)]++
+	}
+	assert.Len(counts, 40)
+	assert.True(counts[1] > 50 && counts[1] < 150, "first key sampled %d times", counts[1])
+	assert.True(counts[40] > 50 && counts[40] < 150, "last key sampled %d times", counts[40])
+
+	keys, values := art.SampleN(rng, -1)
+	assert.Empty(keys)
+	assert.Empty(values)
+}
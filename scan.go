@@ -0,0 +1,51 @@
+package art
+
+import "sync"
+
+var iteratorPool = sync.Pool{
+	New: func() interface{} {
+		return new(iterator)
+	},
+}
+
+// ScanInto fill keys and vals with keys in [begin, end) and their values in ascending order,
+// and return the number of filled entries, which is at most the length of the shorter one.
+// If end is nil, the range has no upper bound. next is the first key not filled because the
+// buffer is full, it can be used as begin of the following scan. next is nil if all keys are filled.
+// This operation is thread safe, and it doesn't allocate memory.
+func (t *ART) ScanInto(begin, end []byte, keys [][]byte, vals []interface{}) (n int, next []byte) {
+	it := iteratorPool.Get().(*iterator)
+	it.begin = begin
+	it.end = end
+	it.includeBegin = true
+	it.unbounded = end == nil
+	it.scan = true
+	it.buf.keys = keys[:min(len(keys), len(vals))]
+	it.buf.vals = vals
+	t.iterate(it)
+
+	n, next = it.buf.n, it.buf.next
+	*it = iterator{}
+	iteratorPool.Put(it)
+	return
+}
+
+type scanBuffer struct {
+	keys [][]byte
+	vals []interface{}
+	n    int
+	next []byte
+}
+
+func (b *scanBuffer) add(key []byte, value interface{}) (full bool) {
+	if b.n == len(b.keys) {
+		b.next = key
+		if b.next == nil {
+			b.next = []byte{}
+		}
+		return true
+	}
+	b.keys[b.n], b.vals[b.n] = key, value
+	b.n++
+	return false
+}
@@ -0,0 +1,60 @@
+package art
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanInto(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	var (
+		result [][]byte
+		bufK   = make([][]byte, 1000)
+		bufV   = make([]interface{}, 1000)
+		next   = keys[10]
+	)
+	for next != nil {
+		var n int
+		n, next = art.ScanInto(next, keys[len(keys)-10], bufK, bufV)
+		for i := 0; i < n; i++ {
+			assert.Equal(bufK[i], bufV[i])
+		}
+		result = append(result, bufK[:n]...)
+	}
+	assert.Equal(keys[10:len(keys)-10], result)
+
+	n, next := art.ScanInto(keys[len(keys)-3], nil, bufK, bufV[:2])
+	assert.Equal(2, n)
+	assert.Equal(keys[len(keys)-1], next)
+	n, next = art.ScanInto(next, nil, bufK, bufV)
+	assert.Equal(1, n)
+	assert.Nil(next)
+
+	// The empty key is returned as a non-nil next key.
+	art.Put(nil, nil)
+	n, next = art.ScanInto(nil, nil, nil, nil)
+	assert.Equal(0, n)
+	assert.Equal([]byte{}, next)
+}
+
+func TestScanIntoAllocs(t *testing.T) {
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	for _, k := range keys {
+		art.Put(k, k)
+	}
+
+	begin, end := []byte("b"), []byte("c")
+	bufK, bufV := make([][]byte, 100), make([]interface{}, 100)
+	allocs := testing.AllocsPerRun(100, func() {
+		art.ScanInto(begin, end, bufK, bufV)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
@@ -0,0 +1,507 @@
+package art
+
+import (
+	"bytes"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Union return a new tree having keys of both a and b. If a key exists in both trees, it's value
+// is decided by resolve, and the value in b is used if resolve is nil.
+// Both trees are walked together, and subtrees only exist in one tree are copied without comparison.
+// Keys put with TTL keep their expiration time in the result, except the values returned by resolve.
+// This operation is thread safe, but the result is not a snapshot if a or b is changed during it.
+func Union(a, b *ART, resolve func(key []byte, a, b interface{}) interface{}) *ART {
+	result := NewART()
+	w := &pairWalker{
+		visitA:  true,
+		visitB:  true,
+		entries: true,
+		f: func(key []byte, va, vb interface{}, inA, inB bool) bool {
+			switch {
+			case inA && inB && resolve != nil:
+				result.Put(key, resolve(key, entryValue(va), entryValue(vb)))
+			case inB:
+				result.putEntry(key, vb)
+			default:
+				result.putEntry(key, va)
+			}
+			return false
+		},
+	}
+	w.walk(a, b)
+	return result
+}
+
+// Intersect return a new tree having keys exist in both a and b with their values in a.
+// Subtrees only exist in one tree are skipped without visiting their keys.
+// Keys put with TTL keep their expiration time in a.
+// This operation is thread safe, but the result is not a snapshot if a or b is changed during it.
+func Intersect(a, b *ART) *ART {
+	result := NewART()
+	w := &pairWalker{
+		entries: true,
+		f: func(key []byte, va, _ interface{}, _, _ bool) bool {
+			result.putEntry(key, va)
+			return false
+		},
+	}
+	w.walk(a, b)
+	return result
+}
+
+// Difference return a new tree having keys exist in a but not in b with their values.
+// Subtrees only exist in b are skipped without visiting their keys.
+// Keys put with TTL keep their expiration time.
+// This operation is thread safe, but the result is not a snapshot if a or b is changed during it.
+func Difference(a, b *ART) *ART {
+	result := NewART()
+	w := &pairWalker{
+		visitA:  true,
+		entries: true,
+		f: func(key []byte, va, _ interface{}, _, inB bool) bool {
+			if !inB {
+				result.putEntry(key, va)
+			}
+			return false
+		},
+	}
+	w.walk(a, b)
+	return result
+}
+
+// pairWalker walk two trees together, and pass keys exist in either tree to f in ascending order.
+// Subtrees exist in both trees are compared by their prefix and children.
+type pairWalker struct {
+	// visitA and visitB mean keys only exist in a or b are passed to f, otherwise
+	// subtrees only exist in that tree are skipped.
+	visitA, visitB bool
+	// skipSame means a subtree shared by both trees is skipped, such as the tree is compared with itself.
+	skipSame bool
+	// entries means values are passed to f by leaf.entry, so they can be put with their expiration time.
+	entries bool
+
+	// prev is the last key passed to f, keys before it are skipped when the walk is restarted.
+	prev []byte
+
+	f func(key []byte, va, vb interface{}, inA, inB bool) (end bool)
+}
+
+func (w *pairWalker) walk(a, b *ART) {
+	for {
+		// Expired keys are treated as absent, like they are removed.
+		nowA, nowB := a.now(), b.now()
+		ra, rb := (*node)(atomic.LoadPointer(&a.root)), (*node)(atomic.LoadPointer(&b.root))
+		va, ok := ra.rLock()
+		if !ok {
+			continue
+		}
+		vb, ok := rb.rLock()
+		if !ok {
+			continue
+		}
+		if _, ok := w.merge(setSide{n: ra, version: va, now: nowA}, setSide{n: rb, version: vb, now: nowB}, 0); ok {
+			return
+		}
+	}
+}
+
+func (w *pairWalker) emit(key []byte, va, vb interface{}, inA, inB bool) bool {
+	if w.prev != nil && bytes.Compare(key, w.prev) <= 0 {
+		return false
+	}
+	if key == nil {
+		key = []byte{}
+	}
+	w.prev = key
+	return w.f(key, va, vb, inA, inB)
+}
+
+// setSide is a subtree of one tree during the walk, it's either an inner node, a leaf, or empty.
+type setSide struct {
+	n       *node
+	version uint64
+	// skip is the number of prefix bytes of n already matched with the other tree.
+	skip int
+	// now is the time keys of the tree are checked for expiration.
+	now int64
+
+	leaf  *leaf
+	key   []byte
+	value interface{}
+}
+
+func (s *setSide) empty() bool {
+	return s.n == nil && s.leaf == nil
+}
+
+func (s *setSide) same(o *setSide) bool {
+	if s.leaf != nil {
+		return s.leaf == o.leaf
+	}
+	return s.n == o.n && s.skip == o.skip
+}
+
+// remainPrefix return the prefix bytes of n not matched yet, depth is the position after skip.
+func (s *setSide) remainPrefix(depth int) ([]byte, bool) {
+	prefix, ok := s.n.appendPrefix(nil, s.version, depth-s.skip)
+	if !ok {
+		return nil, false
+	}
+	return prefix[s.skip:], true
+}
+
+// childSide return the side of child under the inner node of parent, child may be nil or a leaf.
+// An expired leaf is an empty side.
+func (w *pairWalker) childSide(parent *setSide, child *node) (setSide, bool) {
+	if child == nil {
+		return setSide{}, true
+	}
+	if child.nodeType == typeLeaf {
+		l := (*leaf)(unsafe.Pointer(child))
+		if l.expired(parent.now) {
+			return setSide{}, parent.n.lockCheck(parent.version)
+		}
+		s := setSide{leaf: l, key: l.key, value: leafValue(l, w.entries), now: parent.now}
+		return s, parent.n.lockCheck(parent.version)
+	}
+	version, ok := child.rLock()
+	if !ok {
+		return setSide{}, false
+	}
+	return setSide{n: child, version: version, now: parent.now}, parent.n.lockCheck(parent.version)
+}
+
+// leafValue return the value of l, or it's entry if entry is true.
+func leafValue(l *leaf, entry bool) interface{} {
+	if entry {
+		return l.entry()
+	}
+	return l.value
+}
+
+// merge walk a and b, both sides are at the same depth.
+func (w *pairWalker) merge(a, b setSide, depth int) (end, ok bool) {
+	switch {
+	case a.empty() && b.empty():
+		return false, true
+	case b.empty():
+		return w.only(a, true)
+	case a.empty():
+		return w.only(b, false)
+	case w.skipSame && a.same(&b):
+		return false, true
+	case a.leaf != nil || b.leaf != nil:
+		return w.mergeLeaf(a, b, depth)
+	}
+
+	pa, ok := a.remainPrefix(depth)
+	if !ok {
+		return false, false
+	}
+	pb, ok := b.remainPrefix(depth)
+	if !ok {
+		return false, false
+	}
+	c := commonPrefixLen(pa, pb)
+	switch {
+	case c < len(pa) && c < len(pb):
+		// The subtrees have no common key.
+		return w.mergeDisjoint(a, b, pa[c] < pb[c])
+	case c == len(pa) && c == len(pb):
+		return w.mergeNodes(a, b, depth+c)
+	case c == len(pa):
+		b.skip += c + 1
+		return w.mergeSplit(a, b, depth+c, pb[c], false)
+	default:
+		a.skip += c + 1
+		return w.mergeSplit(b, a, depth+c, pa[c], true)
+	}
+}
+
+// only walk keys of a subtree only exist in one tree.
+func (w *pairWalker) only(s setSide, inA bool) (end, ok bool) {
+	if (inA && !w.visitA) || (!inA && !w.visitB) {
+		return false, true
+	}
+	f := func(key []byte, value interface{}) bool {
+		if inA {
+			return w.emit(key, value, nil, true, false)
+		}
+		return w.emit(key, nil, value, false, true)
+	}
+	if s.leaf != nil {
+		return f(s.key, s.value), true
+	}
+	return s.n.eachOpt(s.version, s.now, w.entries, f)
+}
+
+// mergeDisjoint walk two subtrees having no common key, aFirst means keys of a are less than b.
+func (w *pairWalker) mergeDisjoint(a, b setSide, aFirst bool) (end, ok bool) {
+	first, second, firstIsA := a, b, true
+	if !aFirst {
+		first, second, firstIsA = b, a, false
+	}
+	if end, ok = w.only(first, firstIsA); end || !ok {
+		return
+	}
+	return w.only(second, !firstIsA)
+}
+
+// mergeLeaf walk two sides and at least one of them is a leaf.
+func (w *pairWalker) mergeLeaf(a, b setSide, depth int) (end, ok bool) {
+	if a.leaf != nil && b.leaf != nil {
+		cmp := bytes.Compare(a.key, b.key)
+		if cmp == 0 {
+			return w.emit(a.key, a.value, b.value, true, true), true
+		}
+		return w.mergeDisjoint(a, b, cmp < 0)
+	}
+
+	leafIsA := a.leaf != nil
+	l, s := a, b
+	if !leafIsA {
+		l, s = b, a
+	}
+	both := func(v interface{}) bool {
+		if leafIsA {
+			return w.emit(l.key, l.value, v, true, true)
+		}
+		return w.emit(l.key, v, l.value, true, true)
+	}
+
+	if (leafIsA && !w.visitB) || (!leafIsA && !w.visitA) {
+		// Only the key of the leaf is needed in the other subtree.
+		v, found, ok := s.n.lookupOpt(s.version, s.skip, l.key, depth, s.now, w.entries)
+		if !ok {
+			return false, false
+		}
+		if found {
+			return both(v), true
+		}
+		return w.only(l, leafIsA)
+	}
+
+	done := false
+	end, ok = s.n.eachOpt(s.version, s.now, w.entries, func(key []byte, value interface{}) bool {
+		if !done {
+			cmp := bytes.Compare(l.key, key)
+			if cmp == 0 {
+				done = true
+				return both(value)
+			}
+			if cmp < 0 {
+				done = true
+				if end, _ := w.only(l, leafIsA); end {
+					return true
+				}
+			}
+		}
+		if leafIsA {
+			return w.emit(key, nil, value, false, true)
+		}
+		return w.emit(key, value, nil, true, false)
+	})
+	if end || !ok || done {
+		return end, ok
+	}
+	return w.only(l, leafIsA)
+}
+
+// mergeNodes walk two inner nodes whose prefixes are the same, depth is the position after prefixes.
+func (w *pairWalker) mergeNodes(a, b setSide, depth int) (end, ok bool) {
+	la, ok := w.childSide(&a, (*node)(atomic.LoadPointer(&a.n.prefixLeaf)))
+	if !ok {
+		return false, false
+	}
+	lb, ok := w.childSide(&b, (*node)(atomic.LoadPointer(&b.n.prefixLeaf)))
+	if !ok {
+		return false, false
+	}
+	if end, ok = w.merge(la, lb, depth); end || !ok {
+		return
+	}
+
+	for next := 0; next < 256; {
+		ka, ca := a.n.childFrom(next)
+		kb, cb := b.n.childFrom(next)
+		if !a.n.lockCheck(a.version) || !b.n.lockCheck(b.version) {
+			return false, false
+		}
+		if ca == nil && cb == nil {
+			break
+		}
+		key := ka
+		if ca == nil || (cb != nil && kb < ka) {
+			key = kb
+		}
+		if ka != key {
+			ca = nil
+		}
+		if kb != key {
+			cb = nil
+		}
+		next = int(key) + 1
+
+		var sa, sb setSide
+		if sa, ok = w.childSide(&a, ca); !ok {
+			return false, false
+		}
+		if sb, ok = w.childSide(&b, cb); !ok {
+			return false, false
+		}
+		if end, ok = w.merge(sa, sb, depth+1); end || !ok {
+			return
+		}
+	}
+	return false, a.n.lockCheck(a.version) && b.n.lockCheck(b.version)
+}
+
+// mergeSplit walk inner node x and y, whose prefix is longer than x. All keys of y are under
+// the child of x at key, depth is the position after the prefix of x, and y is already skipped
+// to the position after key. If swapped is true, x is from b and y is from a.
+func (w *pairWalker) mergeSplit(x, y setSide, depth int, key byte, swapped bool) (end, ok bool) {
+	merge := func(sx, sy setSide, depth int) (end, ok bool) {
+		if swapped {
+			return w.merge(sy, sx, depth)
+		}
+		return w.merge(sx, sy, depth)
+	}
+
+	// The prefix leaf of x is less than all keys of y.
+	l, ok := w.childSide(&x, (*node)(atomic.LoadPointer(&x.n.prefixLeaf)))
+	if !ok {
+		return false, false
+	}
+	if end, ok = merge(l, setSide{}, depth); end || !ok {
+		return
+	}
+
+	found := false
+	for next := 0; next < 256; {
+		k, child := x.n.childFrom(next)
+		if !x.n.lockCheck(x.version) {
+			return false, false
+		}
+		if child == nil {
+			break
+		}
+		next = int(k) + 1
+
+		if !found && k > key {
+			found = true
+			if end, ok = merge(setSide{}, y, depth+1); end || !ok {
+				return
+			}
+		}
+		var s, sy setSide
+		if s, ok = w.childSide(&x, child); !ok {
+			return false, false
+		}
+		if k == key {
+			sy, found = y, true
+		}
+		if end, ok = merge(s, sy, depth+1); end || !ok {
+			return
+		}
+	}
+	if !found {
+		if end, ok = merge(setSide{}, y, depth+1); end || !ok {
+			return
+		}
+	}
+	return false, x.n.lockCheck(x.version) && y.n.lockCheck(y.version)
+}
+
+// eachOpt call f with all keys and values in subtree n in ascending order until f return true.
+// Keys expired at now are skipped, and values are read by leaf.entry if entry is true.
+func (n *node) eachOpt(version uint64, now int64, entry bool, f func(key []byte, value interface{}) bool) (end, ok bool) {
+	if l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf)); l != nil {
+		k, v, dead := l.key, leafValue(l, entry), l.expired(now)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if !dead && f(k, v) {
+			return true, true
+		}
+	}
+	for next := 0; next < 256; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return false, false
+		}
+		if child == nil {
+			break
+		}
+		next = int(key) + 1
+
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, v, dead := l.key, leafValue(l, entry), l.expired(now)
+			if !n.lockCheck(version) {
+				return false, false
+			}
+			if !dead && f(k, v) {
+				return true, true
+			}
+			continue
+		}
+		childVersion, ok := child.rLock()
+		if !ok {
+			return false, false
+		}
+		if end, ok := child.eachOpt(childVersion, now, entry, f); end || !ok {
+			return end, ok
+		}
+	}
+	return false, n.lockCheck(version)
+}
+
+// lookupOpt find key in subtree n, whose first skip prefix bytes are already matched at depth.
+// A key expired at now is not found, and the value is read by leaf.entry if entry is true.
+func (n *node) lookupOpt(version uint64, skip int, key []byte, depth int, now int64, entry bool) (value interface{}, found, ok bool) {
+	for {
+		prefix, ok := n.appendPrefix(nil, version, depth-skip)
+		if !ok {
+			return nil, false, false
+		}
+		if !bytes.HasPrefix(key[depth:], prefix[skip:]) {
+			return nil, false, n.lockCheck(version)
+		}
+		depth += len(prefix) - skip
+
+		if depth == len(key) {
+			l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf))
+			if l == nil {
+				return nil, false, n.lockCheck(version)
+			}
+			v, dead := leafValue(l, entry), l.expired(now)
+			return v, !dead, n.lockCheck(version)
+		}
+
+		child, _, _ := n.findChild(key[depth])
+		if !n.lockCheck(version) {
+			return nil, false, false
+		}
+		if child == nil {
+			return nil, false, true
+		}
+		if child.nodeType == typeLeaf {
+			l := (*leaf)(unsafe.Pointer(child))
+			k, v, dead := l.key, leafValue(l, entry), l.expired(now)
+			if !n.lockCheck(version) {
+				return nil, false, false
+			}
+			return v, !dead && bytes.Equal(k, key), true
+		}
+		childVersion, ok := child.rLock()
+		if !ok {
+			return nil, false, false
+		}
+		if !n.lockCheck(version) {
+			return nil, false, false
+		}
+		n, version, skip = child, childVersion, 0
+		depth++
+	}
+}
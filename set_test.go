@@ -0,0 +1,145 @@
+package art
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectMap(art *ART) map[string]interface{} {
+	m := make(map[string]interface{})
+	art.Prefix(nil, func(key []byte, value interface{}) bool {
+		m[string(key)] = value
+		return false
+	})
+	return m
+}
+
+func newSetTestTrees() (a, b *ART, ma, mb map[string]interface{}) {
+	a, b = NewART(), NewART()
+	ma, mb = make(map[string]interface{}), make(map[string]interface{})
+	for i, k := range loadTestData("words.txt", nil) {
+		if i%3 != 0 {
+			a.Put(k, "a")
+			ma[string(k)] = "a"
+		}
+		if i%5 != 0 {
+			b.Put(k, "b")
+			mb[string(k)] = "b"
+		}
+		if i%7 == 0 {
+			// Keys with long prefix only exist in one tree.
+			long := []byte(fmt.Sprintf("verylongcommonprefix%s", k))
+			a.Put(long, "a")
+			ma[string(long)] = "a"
+		}
+	}
+	a.Put(nil, "a")
+	ma[""] = "a"
+	return
+}
+
+func TestSetOperations(t *testing.T) {
+	assert := assert.New(t)
+	a, b, ma, mb := newSetTestTrees()
+
+	union := make(map[string]interface{})
+	intersect := make(map[string]interface{})
+	diffAB := make(map[string]interface{})
+	diffBA := make(map[string]interface{})
+	for k, v := range ma {
+		union[k] = v
+		if _, ok := mb[k]; ok {
+			union[k] = "ab"
+			intersect[k] = v
+		} else {
+			diffAB[k] = v
+		}
+	}
+	for k, v := range mb {
+		if _, ok := ma[k]; !ok {
+			union[k] = v
+			diffBA[k] = v
+		}
+	}
+
+	assert.Equal(union, collectMap(Union(a, b, func(key []byte, a, b interface{}) interface{} {
+		return a.(string) + b.(string)
+	})))
+	assert.Equal(intersect, collectMap(Intersect(a, b)))
+	assert.Equal(diffAB, collectMap(Difference(a, b)))
+	assert.Equal(diffBA, collectMap(Difference(b, a)))
+
+	for k := range union {
+		union[k] = "b"
+	}
+	for k, v := range ma {
+		if _, ok := mb[k]; !ok {
+			union[k] = v
+		}
+	}
+	assert.Equal(union, collectMap(Union(a, b, nil)))
+
+	empty := NewART()
+	assert.Equal(ma, collectMap(Union(a, empty, nil)))
+	assert.Empty(collectMap(Intersect(a, empty)))
+	assert.Empty(collectMap(Difference(a, a)))
+	assert.Equal(ma, collectMap(Intersect(a, a)))
+}
+
+func TestSetOperationsPrefix(t *testing.T) {
+	assert := assert.New(t)
+	cases := [][2][]string{
+		{{"abcdefghijklmnopqrstuvwxyz1", "abcdefghijklmnopqrstuvwxyz2"}, {"abcdefghijklmnopqrstuvwxyz1", "abcdefghijklmnop"}},
+		{{"abc", "abd"}, {"abcdefghijklmnopq1", "abcdefghijklmnopq2", "abc"}},
+		{{"a", "ab", "abc"}, {"abc", "abcd", "abcde"}},
+		{{"x1", "x2"}, {"y1", "y2"}},
+		{{"prefix1", "prefix2", "prefix3"}, {"prefix"}},
+	}
+	for _, c := range cases {
+		a, b := newARTWithKeys(c[0]...), newARTWithKeys(c[1]...)
+		var union, intersect, diff []string
+		inB := make(map[string]bool)
+		for _, k := range c[1] {
+			inB[k] = true
+		}
+		for _, k := range c[0] {
+			if inB[k] {
+				intersect = append(intersect, k)
+			} else {
+				diff = append(diff, k)
+			}
+		}
+		union = append(append(union, diff...), c[1]...)
+		assert.Equal(collectMap(newARTWithKeys(union...)), collectMap(Union(a, b, nil)), "%v", c)
+		assert.Equal(collectMap(newARTWithKeys(intersect...)), collectMap(Intersect(a, b)), "%v", c)
+		assert.Equal(collectMap(newARTWithKeys(diff...)), collectMap(Difference(a, b)), "%v", c)
+	}
+}
+
+func TestConcurrentSetOperations(t *testing.T) {
+	assert := assert.New(t)
+	a, b, ma, mb := newSetTestTrees()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10000; i++ {
+			k := []byte(fmt.Sprintf("concurrent%d", i))
+			b.Put(k, nil)
+			b.Delete(k)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		result := collectMap(Intersect(a, b))
+		for k := range result {
+			_, inA := ma[k]
+			_, inB := mb[k]
+			assert.True(inA && inB, "unexpected key %s", k)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,304 @@
+package art
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// Split partitions this tree into two trees, the first one holds keys less than the given key
+// and the second one holds keys greater than or equal to it.
+// Subtrees which are not on the path of key are moved into the new trees instead of being copied,
+// so this tree will be empty after Split return. Keys put with TTL keep expiring in the new trees,
+// but they are only removed by Delete near them. The background sweeper of this tree is stopped
+// before the split, and it's started again by the next PutWithTTL.
+// This operation is NOT thread safe, the caller must ensure no other operation on this tree
+// run concurrently.
+func (t *ART) Split(key []byte) (*ART, *ART) {
+	t.sweeper.reset()
+	root := t.root
+	t.root = unsafe.Pointer(newNode4())
+
+	left, right := splitNode(root, key, 0)
+	if left == nil {
+		left = unsafe.Pointer(newNode4())
+	}
+	if right == nil {
+		right = unsafe.Pointer(newNode4())
+	}
+	return &ART{root: left, expiring: t.expiring}, &ART{root: right, expiring: t.expiring}
+}
+
+// Join concatenate two trees into a new tree, every key in a must be less than every key in b.
+// Nodes of a and b are reused by the new tree, so a and b will be empty after Join return.
+// Like Split, background sweepers of a and b are stopped before the join.
+// This operation is NOT thread safe, the caller must ensure no other operation on a and b
+// run concurrently.
+func Join(a, b *ART) *ART {
+	a.sweeper.reset()
+	b.sweeper.reset()
+	ra, rb := a.root, b.root
+	expiring := a.expiring | b.expiring
+	a.root, b.root = unsafe.Pointer(newNode4()), unsafe.Pointer(newNode4())
+
+	if (*node)(ra).isEmpty() {
+		return &ART{root: rb, expiring: expiring}
+	}
+	if (*node)(rb).isEmpty() {
+		return &ART{root: ra, expiring: expiring}
+	}
+	// numChildren of a full node256 is 0, so the bounds are always checked.
+	maxKey, _, _, _ := (*node)(ra).maximalOpt(nil, 0)
+	minKey, _, _, _ := (*node)(rb).minimalOpt(nil, 0)
+	if bytes.Compare(maxKey, minKey) >= 0 {
+		panic("opt-art: join trees with overlapping keys")
+	}
+
+	return &ART{root: joinNode(ra, rb, 0), expiring: expiring}
+}
+
+// splitNode split the subtree n at depth into two subtrees, which may be nil if there is no key in it.
+// Nodes on the split path are rebuilt, and the rest nodes are reused.
+func splitNode(n unsafe.Pointer, key []byte, depth int) (left, right unsafe.Pointer) {
+	if (*node)(n).nodeType == typeLeaf {
+		if bytes.Compare((*leaf)(n).key, key) < 0 {
+			return n, nil
+		}
+		return nil, n
+	}
+
+	inner := (*node)(n)
+	prefixEnd := depth + inner.prefixLen
+	var fullKey []byte
+	if inner.prefixLen > 0 {
+		fullKey = inner.anyKey()
+		l := min(prefixEnd, len(key))
+		if cmp := bytes.Compare(fullKey[depth:l], key[depth:l]); cmp < 0 {
+			return n, nil
+		} else if cmp > 0 {
+			return nil, n
+		}
+	}
+	if len(key) <= prefixEnd {
+		// All keys in this subtree have the given key as prefix.
+		return nil, n
+	}
+
+	var le, re nodeEntries
+	le.prefixLeaf = inner.prefixLeaf
+	b := key[prefixEnd]
+	inner.eachChild(func(k byte, child unsafe.Pointer) {
+		switch {
+		case k < b:
+			le.add(k, child)
+		case k > b:
+			re.add(k, child)
+		default:
+			cl, cr := splitNode(child, key, prefixEnd+1)
+			if cl != nil {
+				le.add(k, cl)
+			}
+			if cr != nil {
+				re.add(k, cr)
+			}
+		}
+	})
+
+	return le.build(fullKey, depth, inner.prefixLen), re.build(fullKey, depth, inner.prefixLen)
+}
+
+// joinNode concatenate two subtrees at depth, every key in x must be less than every key in y.
+func joinNode(x, y unsafe.Pointer, depth int) unsafe.Pointer {
+	kx, ky := entryKey(x), entryKey(y)
+	ex, ey := prefixEnd(x, kx, depth), prefixEnd(y, ky, depth)
+	i := depth
+	for i < ex && i < ey && kx[i] == ky[i] {
+		i++
+	}
+
+	var e nodeEntries
+	switch {
+	case i < ex && i < ey:
+		// Two subtrees diverge inside their prefix, just put them under a new node.
+		e.add(kx[i], trimPrefix(x, kx, depth, i+1))
+		e.add(ky[i], trimPrefix(y, ky, depth, i+1))
+	case i == ex && i < ey:
+		// y is under x.
+		if (*node)(x).nodeType == typeLeaf {
+			e.prefixLeaf = x
+		} else {
+			e.prefixLeaf = (*node)(x).prefixLeaf
+			(*node)(x).eachChild(e.add)
+		}
+		child := trimPrefix(y, ky, depth, i+1)
+		if last := len(e.keys) - 1; last >= 0 && e.keys[last] == ky[i] {
+			e.children[last] = joinNode(e.children[last], child, i+1)
+		} else {
+			e.add(ky[i], child)
+		}
+	case i == ey && i < ex:
+		// x is under y, y must not have prefix leaf because it is smaller than keys in x.
+		child := trimPrefix(x, kx, depth, i+1)
+		e.add(kx[i], child)
+		(*node)(y).eachChild(func(k byte, c unsafe.Pointer) {
+			if k == kx[i] {
+				e.children[0] = joinNode(child, c, i+1)
+				return
+			}
+			e.add(k, c)
+		})
+	default:
+		// x and y have same prefix, so y must be an inner node without prefix leaf.
+		if (*node)(x).nodeType == typeLeaf {
+			e.prefixLeaf = x
+		} else {
+			e.prefixLeaf = (*node)(x).prefixLeaf
+			(*node)(x).eachChild(e.add)
+		}
+		last := len(e.keys) - 1
+		(*node)(y).eachChild(func(k byte, c unsafe.Pointer) {
+			if last >= 0 && k == e.keys[last] {
+				e.children[last] = joinNode(e.children[last], c, i+1)
+				return
+			}
+			e.add(k, c)
+		})
+	}
+
+	if depth == 0 {
+		return unsafe.Pointer(e.buildNode(kx, depth, 0))
+	}
+	return e.build(kx, depth, i-depth)
+}
+
+// nodeEntries collect the content of an inner node which is being rebuilt.
+type nodeEntries struct {
+	prefixLeaf unsafe.Pointer
+	keys       []byte
+	children   []unsafe.Pointer
+}
+
+func (e *nodeEntries) add(key byte, child unsafe.Pointer) {
+	e.keys = append(e.keys, key)
+	e.children = append(e.children, child)
+}
+
+// build create the smallest subtree holding entries at depth. It may return a leaf or a
+// compressed child if there is only one entry, or nil if there is nothing.
+// The root (depth is zero) is always an inner node without prefix.
+func (e *nodeEntries) build(fullKey []byte, depth, prefixLen int) unsafe.Pointer {
+	if depth == 0 {
+		return unsafe.Pointer(e.buildNode(fullKey, depth, 0))
+	}
+
+	switch {
+	case len(e.children) == 0:
+		return e.prefixLeaf
+	case len(e.children) == 1 && e.prefixLeaf == nil:
+		child := e.children[0]
+		if (*node)(child).nodeType != typeLeaf {
+			c := (*node)(child)
+			c.setPrefix(c.anyKey(), depth, prefixLen+1+c.prefixLen)
+		}
+		return child
+	}
+	return unsafe.Pointer(e.buildNode(fullKey, depth, prefixLen))
+}
+
+func (e *nodeEntries) buildNode(fullKey []byte, depth, prefixLen int) *node {
+	var n *node
+	switch l := len(e.children); {
+	case l <= 4:
+		n = &newNode4().node
+	case l <= 16:
+		n = &newNode16().node
+	case l <= 48:
+		n = &newNode48().node
+	default:
+		n = &newNode256().node
+	}
+	for i := range e.children {
+		n.insertChild(e.keys[i], e.children[i])
+	}
+	n.prefixLeaf = e.prefixLeaf
+	n.setPrefix(fullKey, depth, prefixLen)
+	return n
+}
+
+// eachChild call f with every child of n in order.
+// The caller must ensure n will not be modified concurrently.
+func (n *node) eachChild(f func(key byte, child unsafe.Pointer)) {
+	switch n.nodeType {
+	case typeNode4:
+		n4 := (*node4)(unsafe.Pointer(n))
+		for i := 0; i < int(n4.numChildren); i++ {
+			f(n4.keys[i], n4.children[i])
+		}
+	case typeNode16:
+		n16 := (*node16)(unsafe.Pointer(n))
+		for i := 0; i < int(n16.numChildren); i++ {
+			f(n16.keys[i], n16.children[i])
+		}
+	case typeNode48:
+		n48 := (*node48)(unsafe.Pointer(n))
+		for i := 0; i < 256; i++ {
+			if pos := n48.index[i]; pos > 0 {
+				f(byte(i), n48.children[pos-1])
+			}
+		}
+	case typeNode256:
+		n256 := (*node256)(unsafe.Pointer(n))
+		for i := 0; i < 256; i++ {
+			if c := n256.children[i]; c != nil {
+				f(byte(i), c)
+			}
+		}
+	}
+}
+
+func (n *node) isEmpty() bool {
+	return n.numChildren == 0 && n.nodeType != typeNode256 && n.prefixLeaf == nil
+}
+
+// anyKey return key of a leaf in the subtree n, which can be used to recover the full prefix.
+func (n *node) anyKey() []byte {
+	for {
+		version, ok := n.rLock()
+		if !ok {
+			continue
+		}
+		if key, ok := n.fullKey(version); ok {
+			return key
+		}
+	}
+}
+
+func (n *node) setPrefix(fullKey []byte, depth, prefixLen int) {
+	n.prefixLen = prefixLen
+	if prefixLen > 0 {
+		copy(n.prefix[:], fullKey[depth:depth+min(prefixLen, maxPrefixLen)])
+	}
+}
+
+// entryKey return key of a leaf in the subtree n.
+func entryKey(n unsafe.Pointer) []byte {
+	if (*node)(n).nodeType == typeLeaf {
+		return (*leaf)(n).key
+	}
+	return (*node)(n).anyKey()
+}
+
+// prefixEnd return the depth after the prefix of n, a leaf's prefix is its remain key.
+func prefixEnd(n unsafe.Pointer, fullKey []byte, depth int) int {
+	if (*node)(n).nodeType == typeLeaf {
+		return len(fullKey)
+	}
+	return depth + (*node)(n).prefixLen
+}
+
+// trimPrefix move the subtree n at depth down to newDepth by dropping the head of its prefix.
+func trimPrefix(n unsafe.Pointer, fullKey []byte, depth, newDepth int) unsafe.Pointer {
+	if inner := (*node)(n); inner.nodeType != typeLeaf {
+		inner.setPrefix(fullKey, newDepth, inner.prefixLen-(newDepth-depth))
+	}
+	return n
+}
@@ -0,0 +1,189 @@
+package art
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectKeys(art *ART) [][]byte {
+	var result [][]byte
+	art.Range([]byte{}, bytes.Repeat([]byte{0xff}, 64), true, true, func(key []byte, _ interface{}) bool {
+		result = append(result, key)
+		return false
+	})
+	return result
+}
+
+func sortedKeys(keys [][]byte) [][]byte {
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+func TestSplitAndJoin(t *testing.T) {
+	assert := assert.New(t)
+	keys := sortedKeys(loadTestData("words.txt", nil))
+
+	for _, pivot := range []int{1, len(keys) / 5, len(keys) / 3, len(keys) / 2, len(keys) - 1} {
+		art := NewART()
+		for _, k := range keys {
+			art.Put(k, k)
+		}
+
+		left, right := art.Split(keys[pivot])
+		assert.Empty(collectKeys(art))
+		assert.Equal(keys[:pivot], collectKeys(left))
+		assert.Equal(keys[pivot:], collectKeys(right))
+		for _, k := range keys[:pivot] {
+			v, ok := left.Get(k)
+			assert.True(ok)
+			assert.Equal(k, v)
+		}
+		for _, k := range keys[pivot:] {
+			v, ok := right.Get(k)
+			assert.True(ok)
+			assert.Equal(k, v)
+		}
+
+		joined := Join(left, right)
+		assert.Empty(collectKeys(left))
+		assert.Empty(collectKeys(right))
+		assert.Equal(keys, collectKeys(joined))
+		for _, k := range keys {
+			v, ok := joined.Get(k)
+			assert.True(ok)
+			assert.Equal(k, v)
+		}
+
+		for _, k := range keys {
+			joined.Delete(k)
+		}
+		assert.Empty(collectKeys(joined))
+	}
+}
+
+func TestSplitLongPrefix(t *testing.T) {
+	assert := assert.New(t)
+	keys := []string{
+		"",
+		"absdwqbsbdbfb",
+		"absdwqbsbdbfbabfbqi21234",
+		"absdwqbsbdbfbbbfaqi21334",
+		"absdwqbsbdbfbbbfbqi11234",
+		"acsdwqbsbdbfbfbfbqi21234",
+		"adsdwqbsbdbfbfbfbqi21234",
+	}
+	splitKeys := []string{
+		"",
+		"a",
+		"absdwqbsbdbfb",
+		"absdwqbsbdbfbb",
+		"absdwqbsbdbfbbbfb",
+		"absdwqbsbdbfbzzz",
+		"acsdwqbsbdbfbfbfbqi21234",
+		"z",
+	}
+
+	for _, sk := range splitKeys {
+		art := newARTWithKeys(keys...)
+		left, right := art.Split([]byte(sk))
+
+		var expectLeft, expectRight [][]byte
+		for _, k := range keys {
+			if k < sk {
+				expectLeft = append(expectLeft, []byte(k))
+			} else {
+				expectRight = append(expectRight, []byte(k))
+			}
+		}
+		assert.Equal(expectLeft, collectKeys(left), sk)
+		assert.Equal(expectRight, collectKeys(right), sk)
+
+		// The new trees must be still valid for update.
+		for _, k := range keys {
+			left.Delete([]byte(k))
+			right.Delete([]byte(k))
+		}
+		assert.Empty(collectKeys(left))
+		assert.Empty(collectKeys(right))
+		left.Put([]byte(sk), sk)
+		right.Put([]byte(sk), sk)
+		assert.Equal([][]byte{[]byte(sk)}, collectKeys(left))
+		assert.Equal([][]byte{[]byte(sk)}, collectKeys(right))
+	}
+}
+
+func TestJoinOverlapping(t *testing.T) {
+	a := newARTWithKeys("a", "c")
+	b := newARTWithKeys("b", "d")
+	assert.Panics(t, func() {
+		Join(a, b)
+	})
+}
+
+func TestJoinOverlappingNode256(t *testing.T) {
+	a, b := NewART(), NewART()
+	for i := 0; i < 256; i++ {
+		a.Put([]byte{byte(i), 'a'}, i)
+		b.Put([]byte{byte(i), 'b'}, i)
+	}
+	assert.Panics(t, func() {
+		Join(a, b)
+	})
+	assert.Panics(t, func() {
+		Join(newARTWithKeys(""), newARTWithKeys("", "a"))
+	})
+}
+
+func TestJoinEmpty(t *testing.T) {
+	assert := assert.New(t)
+	a := newARTWithKeys("a", "b")
+	joined := Join(NewART(), a)
+	assert.Equal([][]byte{[]byte("a"), []byte("b")}, collectKeys(joined))
+
+	joined = Join(joined, NewART())
+	assert.Equal([][]byte{[]byte("a"), []byte("b")}, collectKeys(joined))
+
+	joined = Join(newARTWithKeys(""), newARTWithKeys("ab", "abc"))
+	assert.Equal([][]byte{[]byte(""), []byte("ab"), []byte("abc")}, collectKeys(joined))
+}
+
+func TestSplitStopSweeper(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	defer art.Close()
+	art.PutWithTTL([]byte("a"), "a", time.Hour)
+	art.PutWithTTL([]byte("b"), "b", -time.Second)
+	done := art.sweeper.done
+
+	// The sweeper must exit before the tree is split, so it never run with Split.
+	left, right := art.Split([]byte("b"))
+	_, ok := <-done
+	assert.False(ok)
+	assert.Nil(art.sweeper.stop)
+	assert.Empty(art.sweeper.deadlines)
+	assert.Equal([][]byte{[]byte("a")}, collectKeys(left))
+
+	left.PutWithTTL([]byte("aa"), "aa", time.Hour)
+	right.PutWithTTL([]byte("d"), "d", time.Hour)
+	ldone, rdone := left.sweeper.done, right.sweeper.done
+	joined := Join(left, right)
+	_, ok = <-ldone
+	assert.False(ok)
+	_, ok = <-rdone
+	assert.False(ok)
+	assert.Nil(left.sweeper.stop)
+	assert.Nil(right.sweeper.stop)
+	assert.Equal([][]byte{[]byte("a"), []byte("aa"), []byte("d")}, collectKeys(joined))
+
+	// The tree is still usable after Split, and PutWithTTL start a new sweeper.
+	art.PutWithTTL([]byte("e"), "e", time.Hour)
+	assert.NotNil(art.sweeper.stop)
+}
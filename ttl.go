@@ -0,0 +1,363 @@
+package art
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// sweepInterval is the interval of the background sweeper removing expired keys.
+const sweepInterval = time.Second
+
+// PutWithTTL is same as Put, but the key expire after ttl.
+// An expired key is invisible to all operations immediately, and it's removed later by a background
+// sweeper, or by a Delete near it. A later Put of the key clear it's expiration time.
+// The removal of an expired key is reported to watchers and HookAfter delete hooks.
+// The sweeper goroutine is started by PutWithTTL, and it exits once all scheduled expiration
+// times are passed, or Close is called.
+// This operation is thread safe.
+func (t *ART) PutWithTTL(key []byte, value interface{}, ttl time.Duration) {
+	t.putExpiring(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// putExpiring put the key which expire at the given unix nano time.
+func (t *ART) putExpiring(key []byte, value interface{}, at int64) {
+	atomic.StoreUint32(&t.expiring, 1)
+	g := t.guard(key, value)
+	for {
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if old, replaced, ok := n.insertOpt(key, &expiring{value: value, expireAt: at}, 0, nil, 0, &t.root, nil, g); ok {
+			if g.vetoed() == nil {
+				t.notifyExpired(g)
+				t.notify(EventPut, key, old, value, replaced)
+				t.sweeper.schedule(t, key, at)
+			}
+			return
+		}
+	}
+}
+
+// ExpiresAt return the time the given key expire at, ok is false if the key does not exist.
+// The zero time is returned for a key without TTL.
+// This operation is thread safe.
+func (t *ART) ExpiresAt(key []byte) (at time.Time, ok bool) {
+	now := t.now()
+	for {
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if _, expireAt, ex, ok := n.searchOpt(key, 0, nil, 0, nil, now); ok {
+			if !ex || expireAt == 0 {
+				return time.Time{}, ex
+			}
+			return time.Unix(0, expireAt), true
+		}
+	}
+}
+
+// Close stop the background sweeper started by PutWithTTL. Expired keys are still invisible
+// after Close, but they are only removed by Delete near them.
+// It's safe to call Close more than once.
+func (t *ART) Close() {
+	t.sweeper.close()
+}
+
+// expiring is the value passed to insertOpt by PutWithTTL, it's unpacked into the leaf.
+type expiring struct {
+	value    interface{}
+	expireAt int64
+}
+
+// set replace the value of l, and return the old value.
+// The caller must lock the node holding l if l is reachable.
+func (l *leaf) set(value interface{}) (old interface{}) {
+	old = l.value
+	if e, ok := value.(*expiring); ok {
+		l.value, l.expireAt = e.value, e.expireAt
+	} else {
+		l.value, l.expireAt = value, 0
+	}
+	return old
+}
+
+// entry return the value of l which can be passed to insertOpt to keep it's expiration time.
+func (l *leaf) entry() interface{} {
+	if l.expireAt == 0 {
+		return l.value
+	}
+	return &expiring{value: l.value, expireAt: l.expireAt}
+}
+
+// expired return true if l is expired at now, it's always false if now is 0.
+func (l *leaf) expired(now int64) bool {
+	return l.expireAt != 0 && l.expireAt <= now
+}
+
+// putEntry put the value returned by leaf.entry, so the key keep it's expiration time.
+func (t *ART) putEntry(key []byte, entry interface{}) {
+	if e, ok := entry.(*expiring); ok {
+		t.putExpiring(key, e.value, e.expireAt)
+		return
+	}
+	t.Put(key, entry)
+}
+
+// entryValue return the value of an entry returned by leaf.entry.
+func entryValue(entry interface{}) interface{} {
+	if e, ok := entry.(*expiring); ok {
+		return e.value
+	}
+	return entry
+}
+
+// liveSizeOpt return the number of keys in subtree n not expired at now, the counting stop
+// once limit keys are found.
+func (n *node) liveSizeOpt(version uint64, now int64, limit int) (int, bool) {
+	count := 0
+	if l := (*leaf)(atomic.LoadPointer(&n.prefixLeaf)); l != nil {
+		dead := l.expired(now)
+		if !n.lockCheck(version) {
+			return 0, false
+		}
+		if !dead {
+			count++
+		}
+	}
+	for next := 0; next < 256 && count < limit; {
+		key, child := n.childFrom(next)
+		if !n.lockCheck(version) {
+			return 0, false
+		}
+		if child == nil {
+			break
+		}
+		next = int(key) + 1
+
+		if child.nodeType == typeLeaf {
+			dead := (*leaf)(unsafe.Pointer(child)).expired(now)
+			if !n.lockCheck(version) {
+				return 0, false
+			}
+			if !dead {
+				count++
+			}
+			continue
+		}
+		childVersion, ok := child.rLock()
+		if !ok {
+			return 0, false
+		}
+		sub, ok := child.liveSizeOpt(childVersion, now, limit-count)
+		if !ok {
+			return 0, false
+		}
+		count += sub
+	}
+	return count, n.rUnlock(version)
+}
+
+// now return the current unix nano time, or 0 if no key is ever put with TTL,
+// so trees not using TTL never read the clock.
+func (t *ART) now() int64 {
+	if atomic.LoadUint32(&t.expiring) == 0 {
+		return 0
+	}
+	return time.Now().UnixNano()
+}
+
+// expired return true if l is expired when the change guarded by g is made.
+func (g *guard) expired(l *leaf) bool {
+	return g != nil && l.expired(g.now)
+}
+
+// reaping return true if the change only remove the key when it's expired.
+func (g *guard) reaping() bool {
+	return g != nil && g.onlyExpired
+}
+
+// reap record an expired leaf removed by the change.
+func (g *guard) reap(key []byte, value interface{}) {
+	g.reaped = append(g.reaped, KV{Key: key, Value: value})
+}
+
+// notifyExpired report expired leaves removed by the change guarded by g.
+func (t *ART) notifyExpired(g *guard) {
+	if g == nil {
+		return
+	}
+	for _, kv := range g.reaped {
+		t.notify(EventDelete, kv.Key, kv.Value, nil, true)
+	}
+	g.reaped = g.reaped[:0]
+}
+
+// reapExpired remove expired leaf children of the locked n as long as n need not shrink,
+// and record them in g.
+func (n *node) reapExpired(parent *node, g *guard) {
+	if g == nil || g.now == 0 {
+		return
+	}
+	for !n.shouldShrink(parent) {
+		var (
+			key  byte
+			dead *leaf
+		)
+		n.eachChild(func(k byte, child unsafe.Pointer) {
+			if dead == nil && (*node)(child).nodeType == typeLeaf && (*leaf)(child).expired(g.now) {
+				key, dead = k, (*leaf)(child)
+			}
+		})
+		if dead == nil {
+			return
+		}
+		_, _, idx := n.findChild(key)
+		n.removeChild(idx)
+		g.reap(dead.key, dead.value)
+	}
+}
+
+// expire remove key if it's expired at now.
+func (t *ART) expire(key []byte, now int64) {
+	g := &guard{key: key, now: now, onlyExpired: true}
+	for {
+		n := (*node)(atomic.LoadPointer(&t.root))
+		if _, _, ok := n.removeOpt(key, 0, nil, 0, &t.root, nil, g); ok {
+			t.notifyExpired(g)
+			return
+		}
+	}
+}
+
+// unexpired call find until it return a key which is not expired, expired keys found by it are removed.
+func (t *ART) unexpired(find func() ([]byte, interface{}, bool)) ([]byte, interface{}, bool) {
+	for {
+		key, value, ex := find()
+		now := t.now()
+		if !ex || now == 0 {
+			return key, value, ex
+		}
+		// The key may be updated after found, so lookup it again to get the latest value.
+		for {
+			n := (*node)(atomic.LoadPointer(&t.root))
+			if v, _, live, ok := n.searchOpt(key, 0, nil, 0, nil, now); ok {
+				if live {
+					return key, v, true
+				}
+				break
+			}
+		}
+		t.expire(key, now)
+	}
+}
+
+// sweeper remove expired keys in background, it's started by PutWithTTL and exit when there is
+// no scheduled key.
+type sweeper struct {
+	mu        sync.Mutex
+	deadlines deadlineHeap
+	closed    bool
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// schedule record the key will expire at the given time, and start the sweeper if needed.
+func (s *sweeper) schedule(t *ART, key []byte, at int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	heap.Push(&s.deadlines, deadline{key: key, at: at})
+	if s.stop == nil {
+		s.stop, s.done = make(chan struct{}), make(chan struct{})
+		go s.run(t, s.stop, s.done)
+	}
+}
+
+func (s *sweeper) run(t *ART, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !s.sweep(t, time.Now().UnixNano()) && s.exit(stop) {
+				return
+			}
+		}
+	}
+}
+
+// exit clear the sweeper started with stop if there is no scheduled key, so the next schedule
+// start a new one.
+func (s *sweeper) exit(stop chan struct{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.deadlines) > 0 || s.stop != stop {
+		return false
+	}
+	s.stop, s.done = nil, nil
+	return true
+}
+
+// sweep remove all keys scheduled to expire before now, and return false if there is no scheduled key left.
+// A key may be put again after scheduled, so it's current expiration time is checked before removing it.
+func (s *sweeper) sweep(t *ART, now int64) bool {
+	for {
+		s.mu.Lock()
+		if len(s.deadlines) == 0 || s.deadlines[0].at > now {
+			left := len(s.deadlines) > 0
+			s.mu.Unlock()
+			return left
+		}
+		d := heap.Pop(&s.deadlines).(deadline)
+		s.mu.Unlock()
+		t.expire(d.key, now)
+	}
+}
+
+func (s *sweeper) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.reset()
+}
+
+// reset stop the running sweeper and wait for it to exit, and drop all scheduled keys.
+// The next schedule start a new sweeper unless s is closed.
+func (s *sweeper) reset() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done, s.deadlines = nil, nil, nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+type deadline struct {
+	key []byte
+	at  int64
+}
+
+type deadlineHeap []deadline
+
+func (h deadlineHeap) Len() int { return len(h) }
+
+func (h deadlineHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+
+func (h deadlineHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *deadlineHeap) Push(x interface{}) {
+	*h = append(*h, x.(deadline))
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return d
+}
@@ -0,0 +1,351 @@
+package art
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutWithTTL(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a", "c", "e")
+	defer art.Close()
+
+	art.PutWithTTL([]byte("b"), "b", time.Hour)
+	art.PutWithTTL([]byte("d"), "d", -time.Second)
+	art.PutWithTTL([]byte(""), "", -time.Second)
+	art.PutWithTTL([]byte("f"), "f", -time.Second)
+
+	v, ok := art.Get([]byte("b"))
+	assert.True(ok)
+	assert.Equal("b", v)
+	_, ok = art.Get([]byte("d"))
+	assert.False(ok)
+	_, ok = art.Get([]byte(""))
+	assert.False(ok)
+	assert.Equal([][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("e")}, collectKeys(art))
+	_, exists := art.GetBatch([][]byte{[]byte("b"), []byte("d")})
+	assert.Equal([]bool{true, false}, exists)
+
+	at, ok := art.ExpiresAt([]byte("b"))
+	assert.True(ok)
+	assert.WithinDuration(time.Now().Add(time.Hour), at, time.Minute)
+	at, ok = art.ExpiresAt([]byte("a"))
+	assert.True(ok)
+	assert.True(at.IsZero())
+	_, ok = art.ExpiresAt([]byte("d"))
+	assert.False(ok)
+
+	// Put clear the expiration time, and an expired key is replaced as a new one.
+	art.Put([]byte("b"), "x")
+	at, ok = art.ExpiresAt([]byte("b"))
+	assert.True(ok)
+	assert.True(at.IsZero())
+	ch, cancel := art.Watch(nil)
+	defer cancel()
+	art.Put([]byte("d"), "x")
+	assert.Equal(Event{Kind: EventDelete, Key: []byte("d"), Old: "d", Existed: true}, <-ch)
+	assert.Equal(Event{Kind: EventPut, Key: []byte("d"), New: "x"}, <-ch)
+
+	k, _, _ := art.Min()
+	assert.Equal("a", string(k))
+	k, _, _ = art.Max()
+	assert.Equal("e", string(k))
+
+	assert.False(art.Move([]byte("f"), []byte("g")))
+	art.PutWithTTL([]byte("c"), "c", time.Hour)
+	assert.True(art.Move([]byte("c"), []byte("cc")))
+	_, ok = art.ExpiresAt([]byte("c"))
+	assert.False(ok)
+	at, ok = art.ExpiresAt([]byte("cc"))
+	assert.True(ok)
+	assert.False(at.IsZero())
+}
+
+func TestExpiredInvisible(t *testing.T) {
+	assert := assert.New(t)
+	a := newARTWithKeys("a", "dir/a", "x/a")
+	defer a.Close()
+	a.PutWithTTL([]byte("t"), "t", time.Hour)
+	for _, k := range []string{"b", "dir/b", "exp/a", "exp/b", "x"} {
+		a.PutWithTTL([]byte(k), k, -time.Second)
+	}
+	b := newARTWithKeys("a")
+	defer b.Close()
+	b.PutWithTTL([]byte("c"), "c", time.Hour)
+	b.PutWithTTL([]byte("dir/a"), "dir/a", -time.Second)
+	b.PutWithTTL([]byte("t"), "t", -time.Second)
+
+	var listed []string
+	a.List(nil, '/', func(key []byte, value interface{}, isCommonPrefix bool) bool {
+		listed = append(listed, string(key))
+		return false
+	})
+	assert.Equal([]string{"a", "dir/", "t", "x/"}, listed)
+	var distinct []string
+	a.DistinctPrefixes(2, func(prefix []byte) bool {
+		distinct = append(distinct, string(prefix))
+		return false
+	})
+	assert.Equal([]string{"di", "x/"}, distinct)
+	assert.Equal(map[string]int{"a": 1, "d": 1, "t": 1, "x": 1}, a.PrefixCounts(nil, 1))
+	var ranged []string
+	a.MultiRange([]KeyRange{{Begin: []byte("a"), End: []byte("c"), IncludeBegin: true}, {Begin: []byte("d"), End: []byte("z")}},
+		func(key []byte, value interface{}) bool {
+			ranged = append(ranged, string(key))
+			return false
+		})
+	assert.Equal([]string{"a", "dir/a", "t", "x/a"}, ranged)
+	_, values := a.SampleN(rand.New(rand.NewSource(0)), 100)
+	for _, v := range values {
+		assert.Contains([]string{"a", "dir/a", "t", "x/a"}, v)
+	}
+
+	union := Union(a, b, nil)
+	defer union.Close()
+	assert.Equal([][]byte{[]byte("a"), []byte("c"), []byte("dir/a"), []byte("t"), []byte("x/a")}, collectKeys(union))
+	for _, k := range []string{"c", "t"} {
+		at, ok := union.ExpiresAt([]byte(k))
+		assert.True(ok)
+		assert.WithinDuration(time.Now().Add(time.Hour), at, time.Minute)
+	}
+	assert.Equal([][]byte{[]byte("a")}, collectKeys(Intersect(a, b)))
+	difference := Difference(a, b)
+	defer difference.Close()
+	assert.Equal([][]byte{[]byte("dir/a"), []byte("t"), []byte("x/a")}, collectKeys(difference))
+	var changes []string
+	Diff(a, b, func(key []byte, old, new interface{}, kind ChangeKind) bool {
+		changes = append(changes, kind.String()+" "+string(key))
+		return false
+	})
+	assert.Equal([]string{"Inserted c", "Deleted dir/a", "Deleted t", "Deleted x/a"}, changes)
+
+	var deleted []string
+	assert.Equal(4, a.DeleteIf(nil, nil, func(key []byte, value interface{}) bool {
+		deleted = append(deleted, string(key))
+		return true
+	}))
+	assert.Equal([]string{"a", "dir/a", "t", "x/a"}, deleted)
+}
+
+func TestPopExpired(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("b", "d")
+	defer art.Close()
+	art.PutWithTTL([]byte("a"), "a", -time.Second)
+	art.PutWithTTL([]byte("c"), "c", -time.Second)
+	art.PutWithTTL([]byte("e"), "e", -time.Second)
+
+	k, _, ok := art.PopMin()
+	assert.True(ok)
+	assert.Equal("b", string(k))
+	k, _, ok = art.PopMax()
+	assert.True(ok)
+	assert.Equal("d", string(k))
+	_, _, ok = art.PopMin()
+	assert.False(ok)
+}
+
+func TestReapExpired(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	defer art.Close()
+	for i := 0; i < 10; i++ {
+		art.PutWithTTL([]byte(fmt.Sprintf("k%d", i)), i, -time.Second)
+	}
+	art.Put([]byte("ka"), "a")
+	art.Put([]byte("kb"), "b")
+
+	ch, cancel := art.Watch(nil)
+	defer cancel()
+	art.Delete([]byte("kb"))
+
+	// Expired siblings are removed until the node need shrink.
+	assert.Len(ch, 12-node16MinSize)
+	for len(ch) > 0 {
+		assert.Equal(EventDelete, (<-ch).Kind)
+	}
+	// Count leaves including expired ones.
+	root := (*node)(atomic.LoadPointer(&art.root))
+	version, ok := root.rLock()
+	assert.True(ok)
+	remain, ok := root.liveSizeOpt(version, 0, math.MaxInt)
+	assert.True(ok)
+	assert.Equal(node16MinSize, remain)
+	assert.Equal([][]byte{[]byte("ka")}, collectKeys(art))
+}
+
+func TestSweepExpired(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	defer art.Close()
+	keys := loadTestData("words.txt", nil)[:1000]
+	for i, k := range keys {
+		art.PutWithTTL(k, k, time.Duration(i%10+1)*time.Hour)
+	}
+	// A key put again with a longer TTL is kept.
+	art.PutWithTTL(keys[0], keys[0], 100*time.Hour)
+	art.Put(keys[1], keys[1])
+
+	var removed int
+	art.OnDelete(HookAfter, func(key []byte, old interface{}) error {
+		removed++
+		return nil
+	})
+	art.sweeper.sweep(art, time.Now().Add(5*time.Hour+time.Minute).UnixNano())
+	assert.Equal(498, removed)
+	assert.Len(art.sweeper.deadlines, 501)
+	assert.Len(collectKeys(art), 502)
+	_, ok := art.Get(keys[0])
+	assert.True(ok)
+	_, ok = art.Get(keys[1])
+	assert.True(ok)
+}
+
+func TestSweepRebuild(t *testing.T) {
+	assert := assert.New(t)
+	for seed := int64(0); seed < 30; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		art := NewART()
+		// Keys sharing long runs of the same byte make prefixes longer than maxPrefixLen.
+		live := make(map[string]bool)
+		for i := 0; i < 300; i++ {
+			key := []byte(strings.Repeat("a", rng.Intn(20)))
+			for j := rng.Intn(4); j > 0; j-- {
+				key = append(key, "ab"[rng.Intn(2)])
+			}
+			switch rng.Intn(3) {
+			case 0:
+				art.Put(key, string(key))
+				live[string(key)] = true
+			case 1:
+				art.PutWithTTL(key, string(key), time.Hour)
+				live[string(key)] = true
+			default:
+				art.PutWithTTL(key, string(key), -time.Second)
+				live[string(key)] = false
+			}
+		}
+		var expected [][]byte
+		for k, ok := range live {
+			if ok {
+				expected = append(expected, []byte(k))
+			}
+		}
+		sort.Slice(expected, func(i, j int) bool {
+			return bytes.Compare(expected[i], expected[j]) < 0
+		})
+
+		art.sweeper.sweep(art, time.Now().UnixNano())
+		assert.Equal(expected, collectKeys(art), "seed %d", seed)
+		// Expired leaves are removed, not only hidden.
+		root := (*node)(atomic.LoadPointer(&art.root))
+		version, _ := root.rLock()
+		size, _ := root.liveSizeOpt(version, 0, math.MaxInt)
+		assert.Equal(len(expected), size, "seed %d", seed)
+
+		for _, k := range expected {
+			v, ok := art.Get(k)
+			assert.True(ok)
+			assert.Equal(string(k), v)
+			art.Delete(k)
+		}
+		assert.Empty(collectKeys(art))
+		art.Close()
+	}
+}
+
+func TestSweepWhileReading(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)[:2000]
+	art := NewART()
+	defer art.Close()
+	for i, k := range keys {
+		if i%2 == 0 {
+			art.PutWithTTL(k, k, 100*time.Millisecond)
+		} else {
+			art.Put(k, k)
+		}
+	}
+
+	// The sweeper remove keys in background while this goroutine keep reading the tree,
+	// keys without TTL must never be missed.
+	for deadline := time.Now().Add(sweepInterval + time.Second); time.Now().Before(deadline); {
+		for i, k := range keys[:100] {
+			if _, ok := art.Get(k); i%2 == 1 {
+				assert.True(ok)
+			}
+		}
+		assert.True(len(collectKeys(art)) >= len(keys)/2)
+	}
+	assert.Len(collectKeys(art), len(keys)/2)
+	art.sweeper.mu.Lock()
+	assert.Empty(art.sweeper.deadlines)
+	assert.Nil(art.sweeper.stop)
+	art.sweeper.mu.Unlock()
+}
+
+func TestClose(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	art.Close()
+	art.PutWithTTL([]byte("a"), "a", time.Hour)
+	assert.Nil(art.sweeper.stop)
+
+	art = NewART()
+	art.PutWithTTL([]byte("a"), "a", time.Hour)
+	done := art.sweeper.done
+	art.Close()
+	art.Close()
+	_, ok := <-done
+	assert.False(ok)
+	_, ok = art.Get([]byte("a"))
+	assert.True(ok)
+}
+
+func TestConcurrentTTL(t *testing.T) {
+	assert := assert.New(t)
+	keys := loadTestData("words.txt", nil)
+	art := NewART()
+	defer art.Close()
+
+	sz := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for i := 0; i < sz; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(keys); j += sz {
+				if j%2 == 0 {
+					art.PutWithTTL(keys[j], keys[j], -time.Second)
+				} else {
+					art.PutWithTTL(keys[j], keys[j], time.Hour)
+				}
+				if j%3 == 0 {
+					art.Delete(keys[j])
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var expected int
+	for j := range keys {
+		if j%2 == 1 && j%3 != 0 {
+			expected++
+			_, ok := art.Get(keys[j])
+			assert.True(ok)
+		}
+	}
+	assert.Len(collectKeys(art), expected)
+}
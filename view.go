@@ -0,0 +1,108 @@
+package art
+
+import (
+	"sync"
+)
+
+var keyBufPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// View is a namespace of ART, all keys passed into or returned from View are relative to its prefix.
+// A View is only a light weight handle, multiple Views can share the same ART with each other
+// and operations on ART directly.
+type View struct {
+	t      *ART
+	prefix []byte
+}
+
+// Sub return a View of this tree which contain keys having the given prefix.
+func (t *ART) Sub(prefix []byte) *View {
+	p := make([]byte, len(prefix))
+	copy(p, prefix)
+	return &View{t: t, prefix: p}
+}
+
+// Sub return a nested View, whose prefix is the given prefix appended to this View's prefix.
+func (v *View) Sub(prefix []byte) *View {
+	return &View{t: v.t, prefix: v.fullKey(prefix)}
+}
+
+// Get lookup this view, and return the value associate with the given key.
+// This operation is thread safe.
+func (v *View) Get(key []byte) (interface{}, bool) {
+	buf := keyBufPool.Get().(*[]byte)
+	*buf = append(append((*buf)[:0], v.prefix...), key...)
+	value, ok := v.t.Get(*buf)
+	keyBufPool.Put(buf)
+	return value, ok
+}
+
+// Put put the given key and value into this view, or replace exist key's value.
+// This operation is thread safe.
+func (v *View) Put(key []byte, value interface{}) {
+	v.t.Put(v.fullKey(key), value)
+}
+
+// Delete delete the given key and it's value from this view.
+// This operation is thread safe.
+func (v *View) Delete(key []byte) {
+	buf := keyBufPool.Get().(*[]byte)
+	*buf = append(append((*buf)[:0], v.prefix...), key...)
+	v.t.Delete(*buf)
+	keyBufPool.Put(buf)
+}
+
+// Prefix find all key have the given prefix in this view.
+// This operation is thread safe.
+func (v *View) Prefix(prefix []byte, f OpFunc) {
+	v.t.Prefix(v.fullKey(prefix), v.wrap(f))
+}
+
+// Range iterate the key in the given range of this view.
+// This operation is thread safe.
+func (v *View) Range(begin, end []byte, includeBegin, includeEnd bool, f OpFunc) {
+	v.t.Range(v.fullKey(begin), v.fullKey(end), includeBegin, includeEnd, v.wrap(f))
+}
+
+// RangeTop is same as Range, but it will terminate after find k keys.
+// This operation is thread safe.
+func (v *View) RangeTop(k int, begin, end []byte, includeBegin, includeEnd bool, f OpFunc) {
+	v.t.RangeTop(k, v.fullKey(begin), v.fullKey(end), includeBegin, includeEnd, v.wrap(f))
+}
+
+// Min return the minimal key and it's value in this view, ok is false if this view is empty.
+// This operation is thread safe.
+func (v *View) Min() ([]byte, interface{}, bool) {
+	key, value, ok := v.t.prefixBound(v.prefix, false)
+	if !ok {
+		return nil, nil, false
+	}
+	return key[len(v.prefix):], value, true
+}
+
+// Max return the maximal key and it's value in this view, ok is false if this view is empty.
+// This operation is thread safe.
+func (v *View) Max() ([]byte, interface{}, bool) {
+	key, value, ok := v.t.prefixBound(v.prefix, true)
+	if !ok {
+		return nil, nil, false
+	}
+	return key[len(v.prefix):], value, true
+}
+
+func (v *View) fullKey(key []byte) []byte {
+	k := make([]byte, len(v.prefix)+len(key))
+	copy(k, v.prefix)
+	copy(k[len(v.prefix):], key)
+	return k
+}
+
+func (v *View) wrap(f OpFunc) OpFunc {
+	l := len(v.prefix)
+	return func(key []byte, value interface{}) bool {
+		return f(key[l:], value)
+	}
+}
@@ -0,0 +1,132 @@
+package art
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewCRUD(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	a, b := art.Sub([]byte("tenant-a/")), art.Sub([]byte("tenant-b/"))
+
+	a.Put([]byte("k1"), "a1")
+	b.Put([]byte("k1"), "b1")
+	a.Put([]byte("k2"), "a2")
+
+	v, ok := a.Get([]byte("k1"))
+	assert.True(ok)
+	assert.Equal("a1", v)
+	v, ok = b.Get([]byte("k1"))
+	assert.True(ok)
+	assert.Equal("b1", v)
+	_, ok = b.Get([]byte("k2"))
+	assert.False(ok)
+	v, ok = art.Get([]byte("tenant-a/k2"))
+	assert.True(ok)
+	assert.Equal("a2", v)
+
+	a.Delete([]byte("k1"))
+	_, ok = a.Get([]byte("k1"))
+	assert.False(ok)
+	v, ok = b.Get([]byte("k1"))
+	assert.True(ok)
+	assert.Equal("b1", v)
+
+	nested := art.Sub([]byte("tenant-")).Sub([]byte("a/"))
+	v, ok = nested.Get([]byte("k2"))
+	assert.True(ok)
+	assert.Equal("a2", v)
+}
+
+func TestViewRange(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a", "b/1", "b/2", "b/3", "b/33", "b", "c/1")
+	view := art.Sub([]byte("b/"))
+
+	var result []string
+	view.Range([]byte("2"), []byte("33"), true, false, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return false
+	})
+	assert.Equal([]string{"2", "3"}, result)
+
+	result = result[:0]
+	view.Prefix([]byte("3"), func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return false
+	})
+	assert.Equal([]string{"3", "33"}, result)
+
+	result = result[:0]
+	view.Prefix(nil, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return false
+	})
+	assert.Equal([]string{"1", "2", "3", "33"}, result)
+
+	result = result[:0]
+	view.RangeTop(2, []byte("1"), []byte("4"), false, false, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return false
+	})
+	assert.Equal([]string{"2", "3"}, result)
+}
+
+func TestViewMinMax(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys(
+		"a",
+		"absdwqbsbdbfbabfbqi21234",
+		"absdwqbsbdbfbbbfaqi21334",
+		"absdwqbsbdbfbbbfbqi11234",
+		"acsdwqbsbdbfbfbfbqi21234",
+	)
+
+	k, v, ok := art.Sub([]byte("absdwqbsbdbfb")).Min()
+	assert.True(ok)
+	assert.Equal([]byte("abfbqi21234"), k)
+	assert.Equal("absdwqbsbdbfbabfbqi21234", v)
+
+	k, v, ok = art.Sub([]byte("absdwqbsbdbfb")).Max()
+	assert.True(ok)
+	assert.Equal([]byte("bbfbqi11234"), k)
+	assert.Equal("absdwqbsbdbfbbbfbqi11234", v)
+
+	k, _, ok = art.Sub([]byte("a")).Min()
+	assert.True(ok)
+	assert.Equal([]byte{}, k)
+
+	_, _, ok = art.Sub([]byte("absdwqbsbdbfc")).Min()
+	assert.False(ok)
+	_, _, ok = art.Sub([]byte("absdwqbsbdbfc")).Max()
+	assert.False(ok)
+	_, _, ok = art.Sub([]byte("b")).Max()
+	assert.False(ok)
+	_, _, ok = NewART().Sub(nil).Min()
+	assert.False(ok)
+
+	k, _, ok = art.Sub(nil).Max()
+	assert.True(ok)
+	assert.Equal([]byte("acsdwqbsbdbfbfbfbqi21234"), k)
+}
+
+func TestPrefixUnbounded(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a", string([]byte{0xff}), string([]byte{0xff, 0xff}), string([]byte{0xff, 0xff, 1}))
+
+	var result []string
+	art.Prefix([]byte{0xff, 0xff}, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return false
+	})
+	assert.Equal([]string{string([]byte{0xff, 0xff}), string([]byte{0xff, 0xff, 1})}, result)
+
+	result = result[:0]
+	art.Prefix(nil, func(key []byte, value interface{}) bool {
+		result = append(result, string(key))
+		return false
+	})
+	assert.Len(result, 4)
+}
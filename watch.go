@@ -0,0 +1,219 @@
+package art
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// watchBufferSize is the number of events buffered for a watcher, events are dropped once the buffer is full.
+const watchBufferSize = 256
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventPut means a key is put into the tree.
+	EventPut EventKind = iota
+	// EventDelete means a key is deleted from the tree.
+	EventDelete
+	// EventOverflow means some events are dropped because the watcher is too slow,
+	// the watcher should read the tree again to catch up.
+	EventOverflow
+)
+
+// Event is a change of a key delivered to watchers.
+type Event struct {
+	Kind EventKind
+	Key  []byte
+	// Old is the value before the change, and Existed is false if the key did not exist.
+	Old     interface{}
+	Existed bool
+	// New is the value after a put.
+	New interface{}
+}
+
+type watcher struct {
+	prefix []byte
+	// exact means only the key equal to prefix is watched.
+	exact bool
+
+	mu         sync.Mutex
+	ch         chan Event
+	overflowed bool
+	closed     bool
+}
+
+func (w *watcher) match(key []byte) bool {
+	if w.exact {
+		return bytes.Equal(key, w.prefix)
+	}
+	return bytes.HasPrefix(key, w.prefix)
+}
+
+// send deliver e without blocking. The last slot of channel is reserved for the overflow event.
+func (w *watcher) send(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if len(w.ch) >= cap(w.ch)-1 {
+		if !w.overflowed {
+			w.overflowed = true
+			w.ch <- Event{Kind: EventOverflow}
+		}
+		return
+	}
+	w.overflowed = false
+	w.ch <- e
+}
+
+func (w *watcher) close() {
+	w.mu.Lock()
+	w.closed = true
+	close(w.ch)
+	w.mu.Unlock()
+}
+
+// Watch return a channel delivering changes of keys having prefix, and a function to stop watching.
+// Events are sent after the changed nodes are unlocked and never block writers. If the watcher
+// falls behind, events are dropped and an EventOverflow is delivered instead.
+// Events of concurrent changes on the same key may be delivered in any order.
+// The channel is closed by cancel.
+func (t *ART) Watch(prefix []byte) (<-chan Event, func()) {
+	w := &watcher{
+		prefix: append([]byte(nil), prefix...),
+		ch:     make(chan Event, watchBufferSize+1),
+	}
+	return w.ch, t.addWatcher(w)
+}
+
+// WaitFor block until key is put or deleted, so it return once a missing key appears or an
+// existing key changes. It return the value after the change, ok is false if the key is deleted.
+// err is ctx.Err() if ctx is done before the change.
+func (t *ART) WaitFor(ctx context.Context, key []byte) (value interface{}, ok bool, err error) {
+	w := &watcher{
+		prefix: append([]byte(nil), key...),
+		exact:  true,
+		ch:     make(chan Event, 2),
+	}
+	cancel := t.addWatcher(w)
+	defer cancel()
+
+	select {
+	case e := <-w.ch:
+		if e.Kind == EventOverflow {
+			value, ok = t.Get(key)
+			return value, ok, nil
+		}
+		return e.New, e.Kind == EventPut, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+func (t *ART) addWatcher(w *watcher) func() {
+	t.updateObservers(func(o *observers) {
+		o.watchers = append(o.watchers, w)
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.updateObservers(func(o *observers) {
+				for i, x := range o.watchers {
+					if x == w {
+						o.watchers = append(o.watchers[:i], o.watchers[i+1:]...)
+						break
+					}
+				}
+			})
+			w.close()
+		})
+	}
+}
+
+// observers is the watchers and hooks of a tree, it's immutable once published.
+type observers struct {
+	watchers    []*watcher
+	putHooks    []*putHook
+	deleteHooks []*deleteHook
+
+	// hasBefore means some hooks are run before changes are published.
+	hasBefore bool
+}
+
+func (o *observers) empty() bool {
+	return len(o.watchers) == 0 && len(o.putHooks) == 0 && len(o.deleteHooks) == 0
+}
+
+// updateObservers replace observers of this tree with a copy changed by f.
+func (t *ART) updateObservers(f func(o *observers)) {
+	t.observeMu.Lock()
+	defer t.observeMu.Unlock()
+	o := new(observers)
+	if p := t.loadObservers(); p != nil {
+		o.watchers = append(o.watchers, p.watchers...)
+		o.putHooks = append(o.putHooks, p.putHooks...)
+		o.deleteHooks = append(o.deleteHooks, p.deleteHooks...)
+	}
+	f(o)
+	if o.empty() {
+		atomic.StorePointer(&t.observers, nil)
+		return
+	}
+	for _, h := range o.putHooks {
+		o.hasBefore = o.hasBefore || h.mode == HookBefore
+	}
+	for _, h := range o.deleteHooks {
+		o.hasBefore = o.hasBefore || h.mode == HookBefore
+	}
+	atomic.StorePointer(&t.observers, unsafe.Pointer(o))
+}
+
+func (t *ART) loadObservers() *observers {
+	return (*observers)(atomic.LoadPointer(&t.observers))
+}
+
+// observed return true if changes of this tree should be reported.
+func (t *ART) observed() bool {
+	return atomic.LoadPointer(&t.observers) != nil
+}
+
+// notify report a change to watchers and after hooks, it must be called after the changed nodes are unlocked.
+func (t *ART) notify(kind EventKind, key []byte, old, new interface{}, existed bool) {
+	o := t.loadObservers()
+	if o == nil {
+		return
+	}
+	// The key may be a buffer reused by the caller, so it's copied once before sent to watchers
+	// and hooks, which may retain it.
+	var copied []byte
+	stable := func() []byte {
+		if copied == nil {
+			copied = append(make([]byte, 0, len(key)), key...)
+		}
+		return copied
+	}
+	for _, w := range o.watchers {
+		if w.match(key) {
+			w.send(Event{Kind: kind, Key: stable(), Old: old, Existed: existed, New: new})
+		}
+	}
+	if kind == EventPut {
+		for _, h := range o.putHooks {
+			if h.mode == HookAfter {
+				h.f(stable(), old, new)
+			}
+		}
+	} else {
+		for _, h := range o.deleteHooks {
+			if h.mode == HookAfter {
+				h.f(stable(), old)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package art
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("a/1", "b/1")
+	ch, cancel := art.Watch([]byte("a/"))
+
+	art.Put([]byte("a/1"), "x")
+	art.Put([]byte("a/2"), "y")
+	art.Put([]byte("b/2"), "z")
+	art.Delete([]byte("a/3"))
+	art.Delete([]byte("a/2"))
+	art.PutBatch([][]byte{[]byte("a/4"), []byte("b/4")}, []interface{}{4, 4})
+	art.Move([]byte("a/4"), []byte("a/5"))
+	art.DeleteIf([]byte("a/"), []byte("a/2"), func(key []byte, value interface{}) bool {
+		return true
+	})
+
+	expected := []Event{
+		{Kind: EventPut, Key: []byte("a/1"), Old: "a/1", Existed: true, New: "x"},
+		{Kind: EventPut, Key: []byte("a/2"), New: "y"},
+		{Kind: EventDelete, Key: []byte("a/2"), Old: "y", Existed: true},
+		{Kind: EventPut, Key: []byte("a/4"), New: 4},
+		{Kind: EventPut, Key: []byte("a/5"), New: 4},
+		{Kind: EventDelete, Key: []byte("a/4"), Old: 4, Existed: true},
+		{Kind: EventDelete, Key: []byte("a/1"), Old: "x", Existed: true},
+	}
+	for _, e := range expected {
+		assert.Equal(e, <-ch)
+	}
+	select {
+	case e := <-ch:
+		assert.Fail("unexpected event", "%v", e)
+	default:
+	}
+
+	cancel()
+	cancel()
+	_, ok := <-ch
+	assert.False(ok)
+	art.Put([]byte("a/6"), nil)
+	assert.False(art.observed())
+}
+
+func TestWatchOverflow(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+	ch, cancel := art.Watch(nil)
+	defer cancel()
+
+	for i := 0; i < watchBufferSize+10; i++ {
+		art.Put([]byte(fmt.Sprintf("%04d", i)), i)
+	}
+	for i := 0; i < watchBufferSize; i++ {
+		e := <-ch
+		assert.Equal(EventPut, e.Kind)
+		assert.Equal(i, e.New)
+	}
+	assert.Equal(EventOverflow, (<-ch).Kind)
+
+	// Events are delivered again once there is room.
+	art.Delete([]byte("0000"))
+	e := <-ch
+	assert.Equal(EventDelete, e.Kind)
+	assert.Equal([]byte("0000"), e.Key)
+}
+
+func TestWatchReusedKey(t *testing.T) {
+	assert := assert.New(t)
+	art := newARTWithKeys("tenant/a", "tenant/b")
+	ch, cancel := art.Watch([]byte("tenant/"))
+	defer cancel()
+
+	// View.Delete pass a pooled buffer as the key.
+	v := art.Sub([]byte("tenant/"))
+	v.Delete([]byte("a"))
+	v.Delete([]byte("b"))
+	assert.Equal([]byte("tenant/a"), (<-ch).Key)
+	assert.Equal([]byte("tenant/b"), (<-ch).Key)
+}
+
+func TestWaitFor(t *testing.T) {
+	assert := assert.New(t)
+	art := NewART()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		art.Put([]byte("ab"), "other")
+		art.Put([]byte("a"), "value")
+	}()
+	value, ok, err := art.WaitFor(context.Background(), []byte("a"))
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal("value", value)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		art.Delete([]byte("a"))
+	}()
+	_, ok, err = art.WaitFor(context.Background(), []byte("a"))
+	assert.NoError(err)
+	assert.False(ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = art.WaitFor(ctx, []byte("a"))
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.False(art.observed())
+}